@@ -0,0 +1,118 @@
+// Copyright 2020 Damien PLÉNARD.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/nicklaw5/helix/v2"
+)
+
+// deviceSlowDown is added to the polling interval of the device code flow
+// each time Twitch asks to slow down.
+const deviceSlowDown = 5 * time.Second
+
+var (
+	serveCommand     = kingpin.Command("serve", "Run the exporter.").Default()
+	authCommand      = kingpin.Command("auth", "Manage the user token of the exporter.")
+	authLoginCommand = authCommand.Command("login",
+		"Obtain a user token with the OAuth device code flow, requesting the scopes of the enabled collectors, and write it to --twitch.access-token-file and --twitch.refresh-token-file.")
+)
+
+// authLogin runs the OAuth device code flow: it prints the verification URL
+// and code to out, waits for the user to authorize the exporter and writes
+// the tokens to the token files.
+func authLogin(ctx context.Context, logger *slog.Logger, out io.Writer) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loading the configuration file: %w", err)
+	}
+	applyStartupConfig(cfg)
+
+	if *twitchClientID == "" {
+		return errors.New("client ID is required")
+	}
+	token := flagUserToken()
+	if token.accessTokenFile == "" || token.refreshTokenFile == "" {
+		return errors.New("--twitch.access-token-file and --twitch.refresh-token-file are required")
+	}
+
+	client, err := helix.NewClient(&helix.Options{
+		ClientID: *twitchClientID,
+	})
+	if err != nil {
+		return err
+	}
+
+	scopes := requiredScopes(collectorConfig(cfg))
+	logger.Debug("requesting a device code", "scopes", scopes)
+
+	device, err := client.RequestDeviceVerificationURI(scopes)
+	if err != nil {
+		return err
+	}
+	if device.ErrorStatus != 0 {
+		return fmt.Errorf("requesting a device code: %s", device.ErrorMessage)
+	}
+
+	fmt.Fprintf(out, "To authorize the exporter, open %s and enter the code %s\n", device.Data.VerificationURI, device.Data.UserCode)
+	if len(scopes) > 0 {
+		fmt.Fprintf(out, "Requested scopes: %s\n", strings.Join(scopes, " "))
+	}
+
+	interval := time.Duration(device.Data.Interval) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(device.Data.ExpiresIn)*time.Second)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return errors.New("the device code expired before the exporter was authorized")
+			}
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		resp, err := client.RequestDeviceAccessToken(device.Data.DeviceCode, scopes)
+		if err != nil {
+			return err
+		}
+
+		switch resp.ErrorMessage {
+		case "":
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += deviceSlowDown
+			continue
+		default:
+			return fmt.Errorf("requesting the tokens: %s", resp.ErrorMessage)
+		}
+
+		if err := token.persist(resp.Data.AccessToken, resp.Data.RefreshToken); err != nil {
+			return fmt.Errorf("writing the tokens: %w", err)
+		}
+		fmt.Fprintf(out, "Authorized with scopes: %s\nTokens written to %s and %s\n",
+			strings.Join(resp.Data.Scopes, " "), token.accessTokenFile, token.refreshTokenFile)
+		return nil
+	}
+}
+
+// runAuthLogin runs authLogin until it completes or the process is
+// interrupted.
+func runAuthLogin(logger *slog.Logger) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return authLogin(ctx, logger, os.Stdout)
+}
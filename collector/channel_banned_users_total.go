@@ -1,8 +1,9 @@
 package collector
 
 import (
-	"errors"
+	"context"
 	"log/slog"
+	"time"
 
 	"github.com/damoun/twitch_exporter/internal/eventsub"
 	"github.com/nicklaw5/helix/v2"
@@ -11,44 +12,44 @@ import (
 
 type channelBannedUsersTotalCollector struct {
 	logger       *slog.Logger
-	client       *helix.Client
+	client       HelixClient
 	channelNames ChannelNames
 
 	channelBannedUsersTotal typedDesc
 }
 
 func init() {
-	registerCollector("channel_banned_users_total", defaultDisabled, NewChannelBannedUsersTotalCollector)
+	registerCollector("channel_banned_users_total", defaultDisabled, 5*time.Minute, lowPriority, userToken("moderation:read"), NewChannelBannedUsersTotalCollector)
 }
 
-func NewChannelBannedUsersTotalCollector(logger *slog.Logger, client *helix.Client, _ *eventsub.Client, channelNames ChannelNames) (Collector, error) {
+func NewChannelBannedUsersTotalCollector(logger *slog.Logger, client HelixClient, _ *eventsub.Client, channels Channels) (Collector, error) {
 	c := channelBannedUsersTotalCollector{
 		logger:       logger,
 		client:       client,
-		channelNames: channelNames,
+		channelNames: channels.Names(),
 
 		channelBannedUsersTotal: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_banned_users_total"),
 			"The number of banned users of a channel.",
-			[]string{"username"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames(), nil,
+		), prometheus.GaugeValue, channels},
 	}
 
 	return c, nil
 }
 
-func (c channelBannedUsersTotalCollector) Update(ch chan<- prometheus.Metric) error {
+func (c channelBannedUsersTotalCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if len(c.channelNames) == 0 {
 		return ErrNoData
 	}
 
-	users, err := getUsers(c.client, c.logger, c.channelNames)
+	users, err := getChannelUsers(ctx, c.client, c.logger, c.channelNames)
 	if err != nil {
 		return err
 	}
 
-	for _, user := range users {
-		total, err := countPaginated(func(cursor string) (int, string, error) {
+	return updateChannels(ctx, users, func(user helix.User) error {
+		total, err := countPaginated(ctx, func(cursor string) (int, string, error) {
 			resp, err := c.client.GetBannedUsers(&helix.BannedUsersParams{
 				BroadcasterID: user.ID,
 				After:         cursor,
@@ -59,7 +60,7 @@ func (c channelBannedUsersTotalCollector) Update(ch chan<- prometheus.Metric) er
 			}
 			if resp.StatusCode != 200 {
 				c.logger.Error("Failed to collect banned users from Twitch helix API", "err", resp.ErrorMessage)
-				return 0, "", errors.New(resp.ErrorMessage)
+				return 0, "", newAPIError(resp.ResponseCommon)
 			}
 			return len(resp.Data.Bans), resp.Data.Pagination.Cursor, nil
 		})
@@ -67,8 +68,8 @@ func (c channelBannedUsersTotalCollector) Update(ch chan<- prometheus.Metric) er
 			return err
 		}
 
-		ch <- c.channelBannedUsersTotal.mustNewConstMetric(float64(total), user.DisplayName)
-	}
+		ch <- c.channelBannedUsersTotal.mustNewChannelMetric(float64(total), user)
 
-	return nil
+		return nil
+	})
 }
@@ -0,0 +1,34 @@
+package collector
+
+import "testing"
+
+func TestChannelBannedUsersTotal(t *testing.T) {
+	_, c := newTestCollector(t, "channel_banned_users_total")
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_banned_users_total The number of banned users of a channel.
+# TYPE twitch_channel_banned_users_total gauge
+twitch_channel_banned_users_total{user_id="1",username="dam0un"} 1
+`)
+}
+
+func TestChannelBannedUsersTotalPaginated(t *testing.T) {
+	s, c := newTestCollector(t, "channel_banned_users_total")
+	s.Respond("/moderation/banned",
+		`{"data": [{"user_id": "3"}, {"user_id": "4"}], "pagination": {"cursor": "1"}}`,
+		`{"data": [{"user_id": "5"}], "pagination": {}}`,
+	)
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_banned_users_total The number of banned users of a channel.
+# TYPE twitch_channel_banned_users_total gauge
+twitch_channel_banned_users_total{user_id="1",username="dam0un"} 3
+`)
+}
+
+func TestChannelBannedUsersTotalError(t *testing.T) {
+	s, c := newTestCollector(t, "channel_banned_users_total")
+	s.Error("/moderation/banned", 401, "Missing scope: moderation:read")
+
+	expectUpdateError(t, c)
+}
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"errors"
 	"log/slog"
 	"strconv"
@@ -11,67 +12,126 @@ import (
 )
 
 type channelBitsLeaderboardCollector struct {
-	logger *slog.Logger
-	client *helix.Client
+	logger       *slog.Logger
+	client       HelixClient
+	channelNames ChannelNames
 
 	channelBitsLeaderboard typedDesc
 }
 
 func init() {
-	registerCollector("channel_bits_leaderboard", defaultDisabled, NewChannelBitsLeaderboardCollector)
+	registerCollector("channel_bits_leaderboard", defaultDisabled, 0, highPriority, userToken("bits:read"), NewChannelBitsLeaderboardCollector)
 }
 
-func NewChannelBitsLeaderboardCollector(logger *slog.Logger, client *helix.Client, _ *eventsub.Client, _ ChannelNames) (Collector, error) {
+func NewChannelBitsLeaderboardCollector(logger *slog.Logger, client HelixClient, _ *eventsub.Client, channels Channels) (Collector, error) {
+	// user_id already identifies the user of a leaderboard entry, so the
+	// broadcaster is identified by broadcaster_id
+	labelNames := []string{"username", "broadcaster_id", "user_name", "user_id", "rank"}
+	if *legacyUsernameLabel {
+		labelNames = []string{"username", "user_name", "user_id", "rank"}
+	}
+
 	c := channelBitsLeaderboardCollector{
-		logger: logger,
-		client: client,
+		logger:       logger,
+		client:       client,
+		channelNames: channels.Names(),
 
 		channelBitsLeaderboard: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_bits_leaderboard"),
 			"The bits leaderboard score for users on a channel.",
-			[]string{"username", "user_name", "user_id", "rank"}, nil,
-		), prometheus.GaugeValue},
+			append(channelVariableLabels(labelNames...), channels.staticLabelNames()...), nil,
+		), prometheus.GaugeValue, channels},
 	}
 
 	return c, nil
 }
 
-func (c channelBitsLeaderboardCollector) Update(ch chan<- prometheus.Metric) error {
-	// GetUsers with nil logins returns the authenticated user
-	authUsers, err := getUsers(c.client, c.logger, nil)
-	if err != nil {
-		return err
+func (c channelBitsLeaderboardCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	clients := tokenClients(c.client)
+
+	// the leaderboard is the one of the token owner: the owner of the default
+	// token is always exposed, and every broadcaster whose channel the
+	// collector runs for with their own token
+	var errs []error
+	configured := make(map[string]bool)
+	if len(clients) > 1 && len(c.channelNames) > 0 {
+		users, err := getChannelUsers(ctx, c.client, c.logger, c.channelNames)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, user := range users {
+			configured[user.ID] = true
+		}
 	}
 
-	if len(authUsers) == 0 {
-		return ErrNoData
+	var (
+		succeeded int
+		seen      = make(map[string]bool)
+	)
+	for i, client := range clients {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// GetUsers with nil logins returns the authenticated user
+		authUsers, err := getUsers(client, c.logger, nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(authUsers) == 0 {
+			errs = append(errs, ErrNoData)
+			continue
+		}
+		if seen[authUsers[0].ID] || (i > 0 && !configured[authUsers[0].ID]) {
+			continue
+		}
+		seen[authUsers[0].ID] = true
+
+		if err := c.update(ctx, ch, client, authUsers[0]); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		succeeded++
 	}
 
-	username := authUsers[0].DisplayName
+	if succeeded > 0 || len(errs) == 0 {
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// update exposes the leaderboard of the broadcaster owning the client token.
+func (c channelBitsLeaderboardCollector) update(ctx context.Context, ch chan<- prometheus.Metric, client HelixClient, broadcaster helix.User) error {
+	username := usernameLabel(broadcaster)
 
 	// GetBitsLeaderboard returns the leaderboard for the authenticated broadcaster
-	bitsResp, err := c.client.GetBitsLeaderboard(&helix.BitsLeaderboardParams{
+	bitsResp, err := client.GetBitsLeaderboard(&helix.BitsLeaderboardParams{
 		Count: 100,
 	})
 	if err != nil {
 		c.logger.Error("Failed to collect bits leaderboard from Twitch helix API", "err", err)
+		reportChannel(ctx, username, broadcaster.ID, err)
 		return err
 	}
 
 	if bitsResp.StatusCode != 200 {
 		c.logger.Error("Failed to collect bits leaderboard from Twitch helix API", "err", bitsResp.ErrorMessage)
-		return errors.New(bitsResp.ErrorMessage)
+		err := newAPIError(bitsResp.ResponseCommon)
+		reportChannel(ctx, username, broadcaster.ID, err)
+		return err
 	}
 
 	for _, entry := range bitsResp.Data.UserBitTotals {
-		ch <- c.channelBitsLeaderboard.mustNewConstMetric(
+		ch <- c.channelBitsLeaderboard.mustNewChannelMetric(
 			float64(entry.Score),
-			username,
+			broadcaster,
 			entry.UserName,
 			entry.UserID,
 			strconv.Itoa(entry.Rank),
 		)
 	}
+	reportChannel(ctx, username, broadcaster.ID, nil)
 
 	return nil
 }
@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/promslog"
+)
+
+func TestChannelBitsLeaderboard(t *testing.T) {
+	_, c := newTestCollector(t, "channel_bits_leaderboard")
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_bits_leaderboard The bits leaderboard score for users on a channel.
+# TYPE twitch_channel_bits_leaderboard gauge
+twitch_channel_bits_leaderboard{broadcaster_id="1",rank="1",user_id="2",user_name="surdaft",username="dam0un"} 500
+twitch_channel_bits_leaderboard{broadcaster_id="1",rank="2",user_id="3",user_name="spammer",username="dam0un"} 100
+`)
+}
+
+func TestChannelBitsLeaderboardError(t *testing.T) {
+	s, c := newTestCollector(t, "channel_bits_leaderboard")
+	s.Error("/bits/leaderboard", 401, "Missing scope: bits:read")
+
+	expectUpdateError(t, c)
+}
+
+func TestChannelBitsLeaderboardWithoutChannels(t *testing.T) {
+	_, client := newTestClient(t)
+
+	// the leaderboard of the default token owner is exposed regardless of the
+	// channels
+	c, err := NewChannelBitsLeaderboardCollector(promslog.NewNopLogger(), client, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectMetrics(t, testCollector{c, t}, `
+# HELP twitch_channel_bits_leaderboard The bits leaderboard score for users on a channel.
+# TYPE twitch_channel_bits_leaderboard gauge
+twitch_channel_bits_leaderboard{broadcaster_id="1",rank="1",user_id="2",user_name="surdaft",username="dam0un"} 500
+twitch_channel_bits_leaderboard{broadcaster_id="1",rank="2",user_id="3",user_name="spammer",username="dam0un"} 100
+`)
+}
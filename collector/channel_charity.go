@@ -1,7 +1,7 @@
 package collector
 
 import (
-	"errors"
+	"context"
 	"log/slog"
 	"math"
 
@@ -12,7 +12,7 @@ import (
 
 type channelCharityCollector struct {
 	logger       *slog.Logger
-	client       *helix.Client
+	client       HelixClient
 	channelNames ChannelNames
 
 	charityCurrentAmount typedDesc
@@ -20,42 +20,42 @@ type channelCharityCollector struct {
 }
 
 func init() {
-	registerCollector("channel_charity", defaultDisabled, NewChannelCharityCollector)
+	registerCollector("channel_charity", defaultDisabled, 0, highPriority, userToken("channel:read:charity"), NewChannelCharityCollector)
 }
 
-func NewChannelCharityCollector(logger *slog.Logger, client *helix.Client, _ *eventsub.Client, channelNames ChannelNames) (Collector, error) {
+func NewChannelCharityCollector(logger *slog.Logger, client HelixClient, _ *eventsub.Client, channels Channels) (Collector, error) {
 	c := channelCharityCollector{
 		logger:       logger,
 		client:       client,
-		channelNames: channelNames,
+		channelNames: channels.Names(),
 
 		charityCurrentAmount: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_charity_current_amount"),
 			"The current amount raised for the charity campaign in a channel.",
-			[]string{"username", "currency"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames("currency"), nil,
+		), prometheus.GaugeValue, channels},
 
 		charityTargetAmount: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_charity_target_amount"),
 			"The target amount for the charity campaign in a channel.",
-			[]string{"username", "currency"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames("currency"), nil,
+		), prometheus.GaugeValue, channels},
 	}
 
 	return c, nil
 }
 
-func (c channelCharityCollector) Update(ch chan<- prometheus.Metric) error {
+func (c channelCharityCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if len(c.channelNames) == 0 {
 		return ErrNoData
 	}
 
-	users, err := getUsers(c.client, c.logger, c.channelNames)
+	users, err := getChannelUsers(ctx, c.client, c.logger, c.channelNames)
 	if err != nil {
 		return err
 	}
 
-	for _, user := range users {
+	return updateChannels(ctx, users, func(user helix.User) error {
 		charityResp, err := c.client.GetCharityCampaigns(&helix.CharityCampaignsParams{
 			BroadcasterID: user.ID,
 		})
@@ -67,21 +67,21 @@ func (c channelCharityCollector) Update(ch chan<- prometheus.Metric) error {
 
 		if charityResp.StatusCode != 200 {
 			c.logger.Error("Failed to collect charity campaigns from Twitch helix API", "err", charityResp.ErrorMessage)
-			return errors.New(charityResp.ErrorMessage)
+			return newAPIError(charityResp.ResponseCommon)
 		}
 
 		if len(charityResp.Data.Campaigns) == 0 {
-			ch <- c.charityCurrentAmount.mustNewConstMetric(0, user.DisplayName, "")
-			ch <- c.charityTargetAmount.mustNewConstMetric(0, user.DisplayName, "")
-			continue
+			ch <- c.charityCurrentAmount.mustNewChannelMetric(0, user, "")
+			ch <- c.charityTargetAmount.mustNewChannelMetric(0, user, "")
+			return nil
 		}
 
 		campaign := charityResp.Data.Campaigns[0]
 		currentValue := float64(campaign.CurrentAmount.Value) / math.Pow(10, float64(campaign.CurrentAmount.DecimalPlaces))
 		targetValue := float64(campaign.TargetAmount.Value) / math.Pow(10, float64(campaign.TargetAmount.DecimalPlaces))
-		ch <- c.charityCurrentAmount.mustNewConstMetric(currentValue, user.DisplayName, campaign.CurrentAmount.Currency)
-		ch <- c.charityTargetAmount.mustNewConstMetric(targetValue, user.DisplayName, campaign.TargetAmount.Currency)
-	}
+		ch <- c.charityCurrentAmount.mustNewChannelMetric(currentValue, user, campaign.CurrentAmount.Currency)
+		ch <- c.charityTargetAmount.mustNewChannelMetric(targetValue, user, campaign.TargetAmount.Currency)
 
-	return nil
+		return nil
+	})
 }
@@ -0,0 +1,23 @@
+package collector
+
+import "testing"
+
+func TestChannelCharity(t *testing.T) {
+	_, c := newTestCollector(t, "channel_charity")
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_charity_current_amount The current amount raised for the charity campaign in a channel.
+# TYPE twitch_channel_charity_current_amount gauge
+twitch_channel_charity_current_amount{currency="USD",user_id="1",username="dam0un"} 860
+# HELP twitch_channel_charity_target_amount The target amount for the charity campaign in a channel.
+# TYPE twitch_channel_charity_target_amount gauge
+twitch_channel_charity_target_amount{currency="USD",user_id="1",username="dam0un"} 15000
+`)
+}
+
+func TestChannelCharityError(t *testing.T) {
+	s, c := newTestCollector(t, "channel_charity")
+	s.Error("/charity/campaigns", 401, "Missing scope: channel:read:charity")
+
+	expectUpdateError(t, c)
+}
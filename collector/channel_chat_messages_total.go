@@ -1,12 +1,12 @@
 package collector
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"sync"
 
 	"github.com/damoun/twitch_exporter/internal/eventsub"
-	"github.com/nicklaw5/helix/v2"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -17,47 +17,60 @@ var (
 
 type MessageCounter map[string]map[string]int
 
-func (m MessageCounter) Add(username string, chatterUsername string) {
-	m.ensure(username, chatterUsername)
+func (m MessageCounter) Add(broadcasterID string, chatterUsername string) {
+	m.ensure(broadcasterID, chatterUsername)
 
 	chatMessagesMutex.Lock()
 	defer chatMessagesMutex.Unlock()
 
-	m[username][chatterUsername]++
+	m[broadcasterID][chatterUsername]++
 }
 
-func (m MessageCounter) Reset(username string, chatterUsername string) {
-	m.ensure(username, chatterUsername)
+func (m MessageCounter) Reset(broadcasterID string, chatterUsername string) {
+	m.ensure(broadcasterID, chatterUsername)
 
 	chatMessagesMutex.Lock()
 	defer chatMessagesMutex.Unlock()
 
-	m[username][chatterUsername] = 0
+	m[broadcasterID][chatterUsername] = 0
 }
 
-// ensure ensures that the username and chatterUsername exist in the map
-func (m MessageCounter) ensure(username string, chatterUsername string) {
-	if _, ok := m[username]; !ok {
-		m[username] = make(map[string]int)
+// ensure ensures that the broadcasterID and chatterUsername exist in the map
+func (m MessageCounter) ensure(broadcasterID string, chatterUsername string) {
+	if _, ok := m[broadcasterID]; !ok {
+		m[broadcasterID] = make(map[string]int)
 	}
 
-	if _, ok := m[username][chatterUsername]; !ok {
-		m[username][chatterUsername] = 0
+	if _, ok := m[broadcasterID][chatterUsername]; !ok {
+		m[broadcasterID][chatterUsername] = 0
 	}
 }
 
-func (m MessageCounter) Get(username string, chatterUsername string) int {
-	m.ensure(username, chatterUsername)
+func (m MessageCounter) Get(broadcasterID string, chatterUsername string) int {
+	m.ensure(broadcasterID, chatterUsername)
 
 	chatMessagesMutex.Lock()
 	defer chatMessagesMutex.Unlock()
 
-	return m[username][chatterUsername]
+	return m[broadcasterID][chatterUsername]
+}
+
+// Chatters returns a copy of the message counts of every chatter in a channel.
+func (m MessageCounter) Chatters(broadcasterID string) map[string]int {
+	chatMessagesMutex.Lock()
+	defer chatMessagesMutex.Unlock()
+
+	chatters := make(map[string]int, len(m[broadcasterID]))
+	for chatterUsername, count := range m[broadcasterID] {
+		chatters[chatterUsername] = count
+	}
+
+	return chatters
 }
 
 type channelChatMessagesCollector struct {
 	logger       *slog.Logger
-	client       *helix.Client
+	client       HelixClient
 	channelNames ChannelNames
 
 	channelChatMessages typedDesc
@@ -66,49 +79,105 @@ type channelChatMessagesCollector struct {
 func init() {
 	// disabled by default since you need to use webhooks to listen for events using an app access token
 	// which requires it to be exposed to the internet
-	registerCollector("channel_chat_messages_total", defaultDisabled, NewChannelChatMessagesCollector)
+	registerCollector("channel_chat_messages_total", defaultDisabled, 0, highPriority, userToken("user:read:chat", "user:bot", "channel:bot"), NewChannelChatMessagesCollector)
+	eventDrivenCollectors["channel_chat_messages_total"] = true
+}
+
+// chatMessageHandler registers the chat message handler of the process once,
+// the eventsub client dispatching every event it receives to its handlers.
+var chatMessageHandler struct {
+	once sync.Once
+	err  error
+}
+
+// handleChatMessages counts the chat messages received by eventsubClient.
+func handleChatMessages(logger *slog.Logger, eventsubClient *eventsub.Client) error {
+	chatMessageHandler.once.Do(func() {
+		chatMessageHandler.err = eventsubClient.On("channel.chat.message", func(eventRaw json.RawMessage) {
+			var event eventsub.ChannelChatMessageEvent
+
+			if err := json.Unmarshal(eventRaw, &event); err != nil {
+				logger.Error("failed to unmarshal channel chat message event", "error", err)
+				return
+			}
+
+			// messages are counted by broadcaster ID, which is kept when the
+			// channel is renamed
+			chatMessages.Add(event.BroadcasterUserID, event.ChatterUserLogin)
+
+			logger.Info(
+				"channel chat message",
+				"count", chatMessages.Get(event.BroadcasterUserID, event.ChatterUserLogin),
+			)
+		})
+	})
+	return chatMessageHandler.err
+}
+
+// chatSubscriptions are the broadcaster IDs whose chat messages the process
+// is subscribed to. Subscriptions outlive the collectors, so that reloading
+// the configuration only subscribes to the channels which were added.
+var chatSubscriptions = struct {
+	mtx sync.Mutex
+	ids map[string]bool
+}{ids: make(map[string]bool)}
+
+// subscribeChatMessages subscribes to the chat messages of the broadcasters
+// which are not subscribed yet, it returns the error of the last failed
+// subscription, which is attempted again on the next call.
+func subscribeChatMessages(logger *slog.Logger, eventsubClient *eventsub.Client, broadcasterIDs []string) error {
+	chatSubscriptions.mtx.Lock()
+	defer chatSubscriptions.mtx.Unlock()
+
+	var err error
+	for _, broadcasterID := range broadcasterIDs {
+		if chatSubscriptions.ids[broadcasterID] {
+			continue
+		}
+		if subErr := eventsubClient.Subscribe("channel.chat.message", broadcasterID); subErr != nil {
+			logger.Error("failed to subscribe to channel chat messages", "broadcaster_id", broadcasterID, "error", subErr)
+			err = subErr
+			continue
+		}
+		chatSubscriptions.ids[broadcasterID] = true
+	}
+	return err
 }
 
-func NewChannelChatMessagesCollector(logger *slog.Logger, client *helix.Client, eventsubClient *eventsub.Client, channelNames ChannelNames) (Collector, error) {
+func NewChannelChatMessagesCollector(logger *slog.Logger, client HelixClient, eventsubClient *eventsub.Client, channels Channels) (Collector, error) {
+	// we keep the use of the username as the label to avoid adding a bunch of duplicate labels under
+	// a new name of broadcaster_username, which would just match with the other metrics using username
+	// however to group by the chatters we provide chatter_username as a label.
+	// this metric would increase label cardinality a lot for larger channels, so it should be used with
+	// care and ideally only on a small subset of channels.
+	channelChatMessages := typedDesc{prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "channel_chat_messages_total"),
+		"The number of chat messages sent in a channel.",
+		channels.labelNames("chatter_username"), nil,
+	), prometheus.CounterValue, channels}
+
 	// this means that eventsub.enabled must be true, otherwise the default client will not be set
 	if eventsubClient == nil {
 		return nil, eventsub.ErrEventsubClientNotSet
 	}
 
 	broadcasterIDs := []string{}
-	users, err := getUsers(client, logger, channelNames)
+	users, err := resolveChannels(client, logger, channels.Names())
 	if err != nil {
 		return nil, err
 	}
 
-	for _, user := range users {
+	for _, user := range uniqueUsers(users) {
 		broadcasterIDs = append(broadcasterIDs, user.ID)
 	}
 
-	err = eventsubClient.On("channel.chat.message", func(eventRaw json.RawMessage) {
-		var event eventsub.ChannelChatMessageEvent
-
-		if err := json.Unmarshal(eventRaw, &event); err != nil {
-			logger.Error("failed to unmarshal channel chat message event", "error", err)
-			return
-		}
-
-		chatMessages.Add(event.BroadcasterUserLogin, event.ChatterUserLogin)
-
-		logger.Info(
-			"channel chat message",
-			"count", chatMessages.Get(event.BroadcasterUserLogin, event.ChatterUserLogin),
-		)
-	})
+	if err := handleChatMessages(logger, eventsubClient); err != nil {
+		return nil, err
+	}
 
 	// todo: we can only subscribe to broadcasters with an access token and refresh token, so this
 	// would generally just be a single user, the broadcaster
-	for _, broadcasterID := range broadcasterIDs {
-		err = eventsubClient.Subscribe("channel.chat.message", broadcasterID)
-		if err != nil {
-			logger.Error("failed to subscribe to channel chat messages", "error", err)
-		}
-	}
+	err = subscribeChatMessages(logger, eventsubClient, broadcasterIDs)
 
 	// in theory the only error this could be is ErrEventsubDefaultClientNotSet which is already handled
 	// but it returns an error in case that expands
@@ -119,33 +188,31 @@ func NewChannelChatMessagesCollector(logger *slog.Logger, client *helix.Client,
 	c := channelChatMessagesCollector{
 		logger:       logger,
 		client:       client,
-		channelNames: channelNames,
-
-		// we keep the use of the username as the label to avoid adding a bunch of duplicate labels under
-		// a new name of broadcaster_username, which would just match with the other metrics using username
-		// however to group by the chatters we provide chatter_username as a label.
-		// this metric would increase label cardinality a lot for larger channels, so it should be used with
-		// care and ideally only on a small subset of channels.
-		channelChatMessages: typedDesc{prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "", "channel_chat_messages_total"),
-			"The number of chat messages sent in a channel.",
-			[]string{"username", "chatter_username"}, nil,
-		), prometheus.CounterValue},
+		channelNames: channels.Names(),
+
+		channelChatMessages: channelChatMessages,
 	}
 
 	return c, nil
 }
 
-func (c channelChatMessagesCollector) Update(ch chan<- prometheus.Metric) error {
+func (c channelChatMessagesCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if len(c.channelNames) == 0 {
 		return ErrNoData
 	}
 
-	// loop all the channels and push the counts
-	for username, count := range chatMessages {
-		for chatterUsername, count := range count {
-			ch <- c.channelChatMessages.mustNewConstMetric(float64(count), username, chatterUsername)
+	users, err := getChannelUsers(ctx, c.client, c.logger, c.channelNames)
+	if err != nil {
+		return err
+	}
+
+	// loop the channels of this collector and push the counts, messages of
+	// every subscribed channel end up in the same counter
+	for _, user := range users {
+		for chatterUsername, count := range chatMessages.Chatters(user.ID) {
+			ch <- c.channelChatMessages.mustNewLoginMetric(float64(count), user, chatterUsername)
 		}
+		reportChannel(ctx, loginLabel(user), user.ID, nil)
 	}
 
 	return nil
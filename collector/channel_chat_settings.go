@@ -1,7 +1,7 @@
 package collector
 
 import (
-	"errors"
+	"context"
 	"log/slog"
 
 	"github.com/damoun/twitch_exporter/internal/eventsub"
@@ -11,7 +11,7 @@ import (
 
 type channelChatSettingsCollector struct {
 	logger       *slog.Logger
-	client       *helix.Client
+	client       HelixClient
 	channelNames ChannelNames
 
 	chatEmoteOnly           typedDesc
@@ -22,44 +22,44 @@ type channelChatSettingsCollector struct {
 }
 
 func init() {
-	registerCollector("channel_chat_settings", defaultEnabled, NewChannelChatSettingsCollector)
+	registerCollector("channel_chat_settings", defaultEnabled, 0, lowPriority, anyToken, NewChannelChatSettingsCollector)
 }
 
-func NewChannelChatSettingsCollector(logger *slog.Logger, client *helix.Client, _ *eventsub.Client, channelNames ChannelNames) (Collector, error) {
+func NewChannelChatSettingsCollector(logger *slog.Logger, client HelixClient, _ *eventsub.Client, channels Channels) (Collector, error) {
 	c := channelChatSettingsCollector{
 		logger:       logger,
 		client:       client,
-		channelNames: channelNames,
+		channelNames: channels.Names(),
 
 		chatEmoteOnly: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_chat_emote_only"),
 			"Whether emote-only mode is enabled in a channel's chat.",
-			[]string{"username"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames(), nil,
+		), prometheus.GaugeValue, channels},
 
 		chatFollowersOnly: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_chat_followers_only"),
 			"Whether followers-only mode is enabled in a channel's chat.",
-			[]string{"username"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames(), nil,
+		), prometheus.GaugeValue, channels},
 
 		chatSubscriberOnly: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_chat_subscriber_only"),
 			"Whether subscriber-only mode is enabled in a channel's chat.",
-			[]string{"username"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames(), nil,
+		), prometheus.GaugeValue, channels},
 
 		chatSlowMode: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_chat_slow_mode"),
 			"Whether slow mode is enabled in a channel's chat.",
-			[]string{"username"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames(), nil,
+		), prometheus.GaugeValue, channels},
 
 		chatSlowModeWaitSeconds: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_chat_slow_mode_wait_seconds"),
 			"The slow mode wait time in seconds for a channel's chat.",
-			[]string{"username"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames(), nil,
+		), prometheus.GaugeValue, channels},
 	}
 
 	return c, nil
@@ -72,17 +72,17 @@ func boolToFloat64(b bool) float64 {
 	return 0
 }
 
-func (c channelChatSettingsCollector) Update(ch chan<- prometheus.Metric) error {
+func (c channelChatSettingsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if len(c.channelNames) == 0 {
 		return ErrNoData
 	}
 
-	users, err := getUsers(c.client, c.logger, c.channelNames)
+	users, err := getChannelUsers(ctx, c.client, c.logger, c.channelNames)
 	if err != nil {
 		return err
 	}
 
-	for _, user := range users {
+	return updateChannels(ctx, users, func(user helix.User) error {
 		settingsResp, err := c.client.GetChatSettings(&helix.GetChatSettingsParams{
 			BroadcasterID: user.ID,
 		})
@@ -94,20 +94,20 @@ func (c channelChatSettingsCollector) Update(ch chan<- prometheus.Metric) error
 
 		if settingsResp.StatusCode != 200 {
 			c.logger.Error("Failed to collect chat settings from Twitch helix API", "err", settingsResp.ErrorMessage)
-			return errors.New(settingsResp.ErrorMessage)
+			return newAPIError(settingsResp.ResponseCommon)
 		}
 
 		if len(settingsResp.Data.Settings) == 0 {
-			continue
+			return nil
 		}
 
 		s := settingsResp.Data.Settings[0]
-		ch <- c.chatEmoteOnly.mustNewConstMetric(boolToFloat64(s.EmoteMode), user.DisplayName)
-		ch <- c.chatFollowersOnly.mustNewConstMetric(boolToFloat64(s.FollowerMode), user.DisplayName)
-		ch <- c.chatSubscriberOnly.mustNewConstMetric(boolToFloat64(s.SubscriberMode), user.DisplayName)
-		ch <- c.chatSlowMode.mustNewConstMetric(boolToFloat64(s.SlowMode), user.DisplayName)
-		ch <- c.chatSlowModeWaitSeconds.mustNewConstMetric(float64(s.SlowModeWaitTime), user.DisplayName)
-	}
-
-	return nil
+		ch <- c.chatEmoteOnly.mustNewChannelMetric(boolToFloat64(s.EmoteMode), user)
+		ch <- c.chatFollowersOnly.mustNewChannelMetric(boolToFloat64(s.FollowerMode), user)
+		ch <- c.chatSubscriberOnly.mustNewChannelMetric(boolToFloat64(s.SubscriberMode), user)
+		ch <- c.chatSlowMode.mustNewChannelMetric(boolToFloat64(s.SlowMode), user)
+		ch <- c.chatSlowModeWaitSeconds.mustNewChannelMetric(float64(s.SlowModeWaitTime), user)
+
+		return nil
+	})
 }
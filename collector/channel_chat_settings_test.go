@@ -0,0 +1,32 @@
+package collector
+
+import "testing"
+
+func TestChannelChatSettings(t *testing.T) {
+	_, c := newTestCollector(t, "channel_chat_settings")
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_chat_emote_only Whether emote-only mode is enabled in a channel's chat.
+# TYPE twitch_channel_chat_emote_only gauge
+twitch_channel_chat_emote_only{user_id="1",username="dam0un"} 0
+# HELP twitch_channel_chat_followers_only Whether followers-only mode is enabled in a channel's chat.
+# TYPE twitch_channel_chat_followers_only gauge
+twitch_channel_chat_followers_only{user_id="1",username="dam0un"} 1
+# HELP twitch_channel_chat_slow_mode Whether slow mode is enabled in a channel's chat.
+# TYPE twitch_channel_chat_slow_mode gauge
+twitch_channel_chat_slow_mode{user_id="1",username="dam0un"} 1
+# HELP twitch_channel_chat_slow_mode_wait_seconds The slow mode wait time in seconds for a channel's chat.
+# TYPE twitch_channel_chat_slow_mode_wait_seconds gauge
+twitch_channel_chat_slow_mode_wait_seconds{user_id="1",username="dam0un"} 30
+# HELP twitch_channel_chat_subscriber_only Whether subscriber-only mode is enabled in a channel's chat.
+# TYPE twitch_channel_chat_subscriber_only gauge
+twitch_channel_chat_subscriber_only{user_id="1",username="dam0un"} 0
+`)
+}
+
+func TestChannelChatSettingsError(t *testing.T) {
+	s, c := newTestCollector(t, "channel_chat_settings")
+	s.Error("/chat/settings", 500, "Internal Server Error")
+
+	expectUpdateError(t, c)
+}
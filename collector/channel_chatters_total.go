@@ -1,7 +1,7 @@
 package collector
 
 import (
-	"errors"
+	"context"
 	"log/slog"
 
 	"github.com/damoun/twitch_exporter/internal/eventsub"
@@ -11,55 +11,57 @@ import (
 
 type channelChattersCollector struct {
 	logger       *slog.Logger
-	client       *helix.Client
+	client       HelixClient
 	channelNames ChannelNames
 
 	channelChattersTotal typedDesc
 }
 
 func init() {
-	registerCollector("channel_chatters_total", defaultDisabled, NewChannelChattersCollector)
+	registerCollector("channel_chatters_total", defaultDisabled, 0, highPriority, userToken("moderator:read:chatters"), NewChannelChattersCollector)
 }
 
-func NewChannelChattersCollector(logger *slog.Logger, client *helix.Client, _ *eventsub.Client, channelNames ChannelNames) (Collector, error) {
+func NewChannelChattersCollector(logger *slog.Logger, client HelixClient, _ *eventsub.Client, channels Channels) (Collector, error) {
 	c := channelChattersCollector{
 		logger:       logger,
 		client:       client,
-		channelNames: channelNames,
+		channelNames: channels.Names(),
 
 		channelChattersTotal: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_chatters_total"),
 			"The number of users in a channel's chat.",
-			[]string{"username"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames(), nil,
+		), prometheus.GaugeValue, channels},
 	}
 
 	return c, nil
 }
 
-func (c channelChattersCollector) Update(ch chan<- prometheus.Metric) error {
+func (c channelChattersCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if len(c.channelNames) == 0 {
 		return ErrNoData
 	}
 
-	// Get authenticated user ID to use as moderator ID
+	// Get authenticated user ID to use as moderator ID, the channels with
+	// their own token are requested as their broadcaster by a ClientRouter
+	var moderatorID string
 	authUsers, err := getUsers(c.client, c.logger, nil)
-	if err != nil {
-		return err
-	}
-
-	if len(authUsers) == 0 {
+	switch {
+	case err == nil && len(authUsers) > 0:
+		moderatorID = authUsers[0].ID
+	case len(tokenClients(c.client)) == 1:
+		if err != nil {
+			return err
+		}
 		return ErrNoData
 	}
 
-	moderatorID := authUsers[0].ID
-
-	users, err := getUsers(c.client, c.logger, c.channelNames)
+	users, err := getChannelUsers(ctx, c.client, c.logger, c.channelNames)
 	if err != nil {
 		return err
 	}
 
-	for _, user := range users {
+	return updateChannels(ctx, users, func(user helix.User) error {
 		chattersResp, err := c.client.GetChannelChatChatters(&helix.GetChatChattersParams{
 			BroadcasterID: user.ID,
 			ModeratorID:   moderatorID,
@@ -72,11 +74,11 @@ func (c channelChattersCollector) Update(ch chan<- prometheus.Metric) error {
 
 		if chattersResp.StatusCode != 200 {
 			c.logger.Error("Failed to collect chatters from Twitch helix API", "err", chattersResp.ErrorMessage)
-			return errors.New(chattersResp.ErrorMessage)
+			return newAPIError(chattersResp.ResponseCommon)
 		}
 
-		ch <- c.channelChattersTotal.mustNewConstMetric(float64(chattersResp.Data.Total), user.DisplayName)
-	}
+		ch <- c.channelChattersTotal.mustNewChannelMetric(float64(chattersResp.Data.Total), user)
 
-	return nil
+		return nil
+	})
 }
@@ -0,0 +1,20 @@
+package collector
+
+import "testing"
+
+func TestChannelChattersTotal(t *testing.T) {
+	_, c := newTestCollector(t, "channel_chatters_total")
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_chatters_total The number of users in a channel's chat.
+# TYPE twitch_channel_chatters_total gauge
+twitch_channel_chatters_total{user_id="1",username="dam0un"} 8
+`)
+}
+
+func TestChannelChattersTotalError(t *testing.T) {
+	s, c := newTestCollector(t, "channel_chatters_total")
+	s.Error("/chat/chatters", 401, "Missing scope: moderator:read:chatters")
+
+	expectUpdateError(t, c)
+}
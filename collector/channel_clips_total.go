@@ -1,8 +1,9 @@
 package collector
 
 import (
-	"errors"
+	"context"
 	"log/slog"
+	"time"
 
 	"github.com/damoun/twitch_exporter/internal/eventsub"
 	"github.com/nicklaw5/helix/v2"
@@ -11,57 +12,57 @@ import (
 
 type channelClipsTotalCollector struct {
 	logger       *slog.Logger
-	client       *helix.Client
+	client       HelixClient
 	channelNames ChannelNames
 
 	channelClips typedDesc
 }
 
 func init() {
-	registerCollector("channel_clips_total", defaultEnabled, NewChannelClipsTotalCollector)
+	registerCollector("channel_clips_total", defaultEnabled, 10*time.Minute, lowPriority, anyToken, NewChannelClipsTotalCollector)
 }
 
-func NewChannelClipsTotalCollector(logger *slog.Logger, client *helix.Client, _ *eventsub.Client, channelNames ChannelNames) (Collector, error) {
+func NewChannelClipsTotalCollector(logger *slog.Logger, client HelixClient, _ *eventsub.Client, channels Channels) (Collector, error) {
 	c := channelClipsTotalCollector{
 		logger:       logger,
 		client:       client,
-		channelNames: channelNames,
+		channelNames: channels.Names(),
 
 		channelClips: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_clips_total"),
 			"The number of clips of a channel.",
-			[]string{"username"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames(), nil,
+		), prometheus.GaugeValue, channels},
 	}
 
 	return c, nil
 }
 
-func (c channelClipsTotalCollector) Update(ch chan<- prometheus.Metric) error {
+func (c channelClipsTotalCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if len(c.channelNames) == 0 {
 		return ErrNoData
 	}
 
-	users, err := getUsers(c.client, c.logger, c.channelNames)
+	users, err := getChannelUsers(ctx, c.client, c.logger, c.channelNames)
 	if err != nil {
 		return err
 	}
 
-	for _, user := range users {
-		total, err := c.countClips(user.ID)
+	return updateChannels(ctx, users, func(user helix.User) error {
+		total, err := c.countClips(ctx, user.ID)
 		if err != nil {
 			c.logger.Error("Failed to collect clips stats from Twitch helix API", "err", err)
 			return err
 		}
 
-		ch <- c.channelClips.mustNewConstMetric(float64(total), user.DisplayName)
-	}
+		ch <- c.channelClips.mustNewChannelMetric(float64(total), user)
 
-	return nil
+		return nil
+	})
 }
 
-func (c channelClipsTotalCollector) countClips(broadcasterID string) (int, error) {
-	return countPaginated(func(cursor string) (int, string, error) {
+func (c channelClipsTotalCollector) countClips(ctx context.Context, broadcasterID string) (int, error) {
+	return countPaginated(ctx, func(cursor string) (int, string, error) {
 		resp, err := c.client.GetClips(&helix.ClipsParams{
 			BroadcasterID: broadcasterID,
 			First:         100,
@@ -71,7 +72,7 @@ func (c channelClipsTotalCollector) countClips(broadcasterID string) (int, error
 			return 0, "", err
 		}
 		if resp.StatusCode != 200 {
-			return 0, "", errors.New(resp.ErrorMessage)
+			return 0, "", newAPIError(resp.ResponseCommon)
 		}
 		return len(resp.Data.Clips), resp.Data.Pagination.Cursor, nil
 	})
@@ -0,0 +1,38 @@
+package collector
+
+import "testing"
+
+func TestChannelClipsTotal(t *testing.T) {
+	_, c := newTestCollector(t, "channel_clips_total")
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_clips_total The number of clips of a channel.
+# TYPE twitch_channel_clips_total gauge
+twitch_channel_clips_total{user_id="1",username="dam0un"} 2
+`)
+}
+
+func TestChannelClipsTotalPaginated(t *testing.T) {
+	s, c := newTestCollector(t, "channel_clips_total")
+	s.Respond("/clips",
+		`{"data": [{"id": "a"}, {"id": "b"}], "pagination": {"cursor": "1"}}`,
+		`{"data": [{"id": "c"}, {"id": "d"}], "pagination": {"cursor": "2"}}`,
+		`{"data": [{"id": "e"}], "pagination": {}}`,
+	)
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_clips_total The number of clips of a channel.
+# TYPE twitch_channel_clips_total gauge
+twitch_channel_clips_total{user_id="1",username="dam0un"} 5
+`)
+	if n := s.Requests("/clips"); n != 3 {
+		t.Errorf("expected 3 clips requests, got %d", n)
+	}
+}
+
+func TestChannelClipsTotalError(t *testing.T) {
+	s, c := newTestCollector(t, "channel_clips_total")
+	s.Error("/clips", 500, "Internal Server Error")
+
+	expectUpdateError(t, c)
+}
@@ -1,8 +1,9 @@
 package collector
 
 import (
-	"errors"
+	"context"
 	"log/slog"
+	"time"
 
 	"github.com/damoun/twitch_exporter/internal/eventsub"
 	"github.com/nicklaw5/helix/v2"
@@ -11,43 +12,43 @@ import (
 
 type channelEmotesTotalCollector struct {
 	logger       *slog.Logger
-	client       *helix.Client
+	client       HelixClient
 	channelNames ChannelNames
 
 	channelEmotesTotal typedDesc
 }
 
 func init() {
-	registerCollector("channel_emotes_total", defaultEnabled, NewChannelEmotesTotalCollector)
+	registerCollector("channel_emotes_total", defaultEnabled, 30*time.Minute, lowPriority, anyToken, NewChannelEmotesTotalCollector)
 }
 
-func NewChannelEmotesTotalCollector(logger *slog.Logger, client *helix.Client, _ *eventsub.Client, channelNames ChannelNames) (Collector, error) {
+func NewChannelEmotesTotalCollector(logger *slog.Logger, client HelixClient, _ *eventsub.Client, channels Channels) (Collector, error) {
 	c := channelEmotesTotalCollector{
 		logger:       logger,
 		client:       client,
-		channelNames: channelNames,
+		channelNames: channels.Names(),
 
 		channelEmotesTotal: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_emotes_total"),
 			"The number of custom emotes of a channel.",
-			[]string{"username"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames(), nil,
+		), prometheus.GaugeValue, channels},
 	}
 
 	return c, nil
 }
 
-func (c channelEmotesTotalCollector) Update(ch chan<- prometheus.Metric) error {
+func (c channelEmotesTotalCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if len(c.channelNames) == 0 {
 		return ErrNoData
 	}
 
-	users, err := getUsers(c.client, c.logger, c.channelNames)
+	users, err := getChannelUsers(ctx, c.client, c.logger, c.channelNames)
 	if err != nil {
 		return err
 	}
 
-	for _, user := range users {
+	return updateChannels(ctx, users, func(user helix.User) error {
 		emotesResp, err := c.client.GetChannelEmotes(&helix.GetChannelEmotesParams{
 			BroadcasterID: user.ID,
 		})
@@ -59,11 +60,11 @@ func (c channelEmotesTotalCollector) Update(ch chan<- prometheus.Metric) error {
 
 		if emotesResp.StatusCode != 200 {
 			c.logger.Error("Failed to collect emotes from Twitch helix API", "err", emotesResp.ErrorMessage)
-			return errors.New(emotesResp.ErrorMessage)
+			return newAPIError(emotesResp.ResponseCommon)
 		}
 
-		ch <- c.channelEmotesTotal.mustNewConstMetric(float64(len(emotesResp.Data.Emotes)), user.DisplayName)
-	}
+		ch <- c.channelEmotesTotal.mustNewChannelMetric(float64(len(emotesResp.Data.Emotes)), user)
 
-	return nil
+		return nil
+	})
 }
@@ -0,0 +1,20 @@
+package collector
+
+import "testing"
+
+func TestChannelEmotesTotal(t *testing.T) {
+	_, c := newTestCollector(t, "channel_emotes_total")
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_emotes_total The number of custom emotes of a channel.
+# TYPE twitch_channel_emotes_total gauge
+twitch_channel_emotes_total{user_id="1",username="dam0un"} 2
+`)
+}
+
+func TestChannelEmotesTotalError(t *testing.T) {
+	s, c := newTestCollector(t, "channel_emotes_total")
+	s.Error("/chat/emotes", 500, "Internal Server Error")
+
+	expectUpdateError(t, c)
+}
@@ -1,7 +1,7 @@
 package collector
 
 import (
-	"errors"
+	"context"
 	"log/slog"
 
 	"github.com/damoun/twitch_exporter/internal/eventsub"
@@ -11,43 +11,43 @@ import (
 
 type channelFollowersTotalCollector struct {
 	logger       *slog.Logger
-	client       *helix.Client
+	client       HelixClient
 	channelNames ChannelNames
 
 	channelFollowers typedDesc
 }
 
 func init() {
-	registerCollector("channel_followers_total", defaultEnabled, NewChannelFollowersTotalCollector)
+	registerCollector("channel_followers_total", defaultEnabled, 0, highPriority, anyToken, NewChannelFollowersTotalCollector)
 }
 
-func NewChannelFollowersTotalCollector(logger *slog.Logger, client *helix.Client, _ *eventsub.Client, channelNames ChannelNames) (Collector, error) {
+func NewChannelFollowersTotalCollector(logger *slog.Logger, client HelixClient, _ *eventsub.Client, channels Channels) (Collector, error) {
 	c := channelFollowersTotalCollector{
 		logger:       logger,
 		client:       client,
-		channelNames: channelNames,
+		channelNames: channels.Names(),
 
 		channelFollowers: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_followers_total"),
 			"The number of followers of a channel.",
-			[]string{"username"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames(), nil,
+		), prometheus.GaugeValue, channels},
 	}
 
 	return c, nil
 }
 
-func (c channelFollowersTotalCollector) Update(ch chan<- prometheus.Metric) error {
+func (c channelFollowersTotalCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if len(c.channelNames) == 0 {
 		return ErrNoData
 	}
 
-	users, err := getUsers(c.client, c.logger, c.channelNames)
+	users, err := getChannelUsers(ctx, c.client, c.logger, c.channelNames)
 	if err != nil {
 		return err
 	}
 
-	for _, user := range users {
+	return updateChannels(ctx, users, func(user helix.User) error {
 		usersFollowsResp, err := c.client.GetChannelFollows(&helix.GetChannelFollowsParams{
 			BroadcasterID: user.ID,
 		})
@@ -59,11 +59,11 @@ func (c channelFollowersTotalCollector) Update(ch chan<- prometheus.Metric) erro
 
 		if usersFollowsResp.StatusCode != 200 {
 			c.logger.Error("Failed to collect follower stats from Twitch helix API", "err", usersFollowsResp.ErrorMessage)
-			return errors.New(usersFollowsResp.ErrorMessage)
+			return newAPIError(usersFollowsResp.ResponseCommon)
 		}
 
-		ch <- c.channelFollowers.mustNewConstMetric(float64(usersFollowsResp.Data.Total), user.DisplayName)
-	}
+		ch <- c.channelFollowers.mustNewChannelMetric(float64(usersFollowsResp.Data.Total), user)
 
-	return nil
+		return nil
+	})
 }
@@ -0,0 +1,20 @@
+package collector
+
+import "testing"
+
+func TestChannelFollowersTotal(t *testing.T) {
+	_, c := newTestCollector(t, "channel_followers_total")
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_followers_total The number of followers of a channel.
+# TYPE twitch_channel_followers_total gauge
+twitch_channel_followers_total{user_id="1",username="dam0un"} 1337
+`)
+}
+
+func TestChannelFollowersTotalError(t *testing.T) {
+	s, c := newTestCollector(t, "channel_followers_total")
+	s.Error("/channels/followers", 500, "Internal Server Error")
+
+	expectUpdateError(t, c)
+}
@@ -1,7 +1,7 @@
 package collector
 
 import (
-	"errors"
+	"context"
 	"log/slog"
 
 	"github.com/damoun/twitch_exporter/internal/eventsub"
@@ -11,7 +11,7 @@ import (
 
 type channelGoalsCollector struct {
 	logger       *slog.Logger
-	client       *helix.Client
+	client       HelixClient
 	channelNames ChannelNames
 
 	goalCurrent typedDesc
@@ -19,42 +19,42 @@ type channelGoalsCollector struct {
 }
 
 func init() {
-	registerCollector("channel_goals", defaultDisabled, NewChannelGoalsCollector)
+	registerCollector("channel_goals", defaultDisabled, 0, highPriority, userToken("channel:read:goals"), NewChannelGoalsCollector)
 }
 
-func NewChannelGoalsCollector(logger *slog.Logger, client *helix.Client, _ *eventsub.Client, channelNames ChannelNames) (Collector, error) {
+func NewChannelGoalsCollector(logger *slog.Logger, client HelixClient, _ *eventsub.Client, channels Channels) (Collector, error) {
 	c := channelGoalsCollector{
 		logger:       logger,
 		client:       client,
-		channelNames: channelNames,
+		channelNames: channels.Names(),
 
 		goalCurrent: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_goal_current"),
 			"The current amount for a creator goal in a channel.",
-			[]string{"username", "type"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames("type"), nil,
+		), prometheus.GaugeValue, channels},
 
 		goalTarget: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_goal_target"),
 			"The target amount for a creator goal in a channel.",
-			[]string{"username", "type"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames("type"), nil,
+		), prometheus.GaugeValue, channels},
 	}
 
 	return c, nil
 }
 
-func (c channelGoalsCollector) Update(ch chan<- prometheus.Metric) error {
+func (c channelGoalsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if len(c.channelNames) == 0 {
 		return ErrNoData
 	}
 
-	users, err := getUsers(c.client, c.logger, c.channelNames)
+	users, err := getChannelUsers(ctx, c.client, c.logger, c.channelNames)
 	if err != nil {
 		return err
 	}
 
-	for _, user := range users {
+	return updateChannels(ctx, users, func(user helix.User) error {
 		goalsResp, err := c.client.GetCreatorGoals(&helix.GetCreatorGoalsParams{
 			BroadcasterID: user.ID,
 		})
@@ -66,14 +66,14 @@ func (c channelGoalsCollector) Update(ch chan<- prometheus.Metric) error {
 
 		if goalsResp.StatusCode != 200 {
 			c.logger.Error("Failed to collect creator goals from Twitch helix API", "err", goalsResp.ErrorMessage)
-			return errors.New(goalsResp.ErrorMessage)
+			return newAPIError(goalsResp.ResponseCommon)
 		}
 
 		for _, goal := range goalsResp.Data.Goals {
-			ch <- c.goalCurrent.mustNewConstMetric(float64(goal.CurrentAmount), user.DisplayName, goal.Type)
-			ch <- c.goalTarget.mustNewConstMetric(float64(goal.TargetAmount), user.DisplayName, goal.Type)
+			ch <- c.goalCurrent.mustNewChannelMetric(float64(goal.CurrentAmount), user, goal.Type)
+			ch <- c.goalTarget.mustNewChannelMetric(float64(goal.TargetAmount), user, goal.Type)
 		}
-	}
 
-	return nil
+		return nil
+	})
 }
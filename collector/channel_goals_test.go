@@ -0,0 +1,23 @@
+package collector
+
+import "testing"
+
+func TestChannelGoals(t *testing.T) {
+	_, c := newTestCollector(t, "channel_goals")
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_goal_current The current amount for a creator goal in a channel.
+# TYPE twitch_channel_goal_current gauge
+twitch_channel_goal_current{type="follower",user_id="1",username="dam0un"} 1337
+# HELP twitch_channel_goal_target The target amount for a creator goal in a channel.
+# TYPE twitch_channel_goal_target gauge
+twitch_channel_goal_target{type="follower",user_id="1",username="dam0un"} 1500
+`)
+}
+
+func TestChannelGoalsError(t *testing.T) {
+	s, c := newTestCollector(t, "channel_goals")
+	s.Error("/goals", 401, "Missing scope: channel:read:goals")
+
+	expectUpdateError(t, c)
+}
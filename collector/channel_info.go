@@ -1,7 +1,7 @@
 package collector
 
 import (
-	"errors"
+	"context"
 	"log/slog"
 
 	"github.com/damoun/twitch_exporter/internal/eventsub"
@@ -11,7 +11,7 @@ import (
 
 type channelInfoCollector struct {
 	logger       *slog.Logger
-	client       *helix.Client
+	client       HelixClient
 	channelNames ChannelNames
 
 	channelInfo         typedDesc
@@ -19,46 +19,46 @@ type channelInfoCollector struct {
 }
 
 func init() {
-	registerCollector("channel_info", defaultEnabled, NewChannelInfoCollector)
+	registerCollector("channel_info", defaultEnabled, 0, highPriority, anyToken, NewChannelInfoCollector)
 }
 
-func NewChannelInfoCollector(logger *slog.Logger, client *helix.Client, _ *eventsub.Client, channelNames ChannelNames) (Collector, error) {
+func NewChannelInfoCollector(logger *slog.Logger, client HelixClient, _ *eventsub.Client, channels Channels) (Collector, error) {
 	c := channelInfoCollector{
 		logger:       logger,
 		client:       client,
-		channelNames: channelNames,
+		channelNames: channels.Names(),
 
 		channelInfo: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_info"),
 			"Channel metadata including game, title and language.",
-			[]string{"username", "game", "title", "language"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames("game", "title", "language"), nil,
+		), prometheus.GaugeValue, channels},
 
 		channelDelaySeconds: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_delay_seconds"),
 			"The stream delay in seconds for a channel.",
-			[]string{"username"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames(), nil,
+		), prometheus.GaugeValue, channels},
 	}
 
 	return c, nil
 }
 
-func (c channelInfoCollector) Update(ch chan<- prometheus.Metric) error {
+func (c channelInfoCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if len(c.channelNames) == 0 {
 		return ErrNoData
 	}
 
-	users, err := getUsers(c.client, c.logger, c.channelNames)
+	users, err := getChannelUsers(ctx, c.client, c.logger, c.channelNames)
 	if err != nil {
 		return err
 	}
 
 	broadcasterIDs := make([]string, 0, len(users))
-	usersByID := make(map[string]string, len(users))
+	usersByID := make(map[string]helix.User, len(users))
 	for _, user := range users {
 		broadcasterIDs = append(broadcasterIDs, user.ID)
-		usersByID[user.ID] = user.DisplayName
+		usersByID[user.ID] = user
 	}
 
 	channelResp, err := c.client.GetChannelInformation(&helix.GetChannelInformationParams{
@@ -72,13 +72,14 @@ func (c channelInfoCollector) Update(ch chan<- prometheus.Metric) error {
 
 	if channelResp.StatusCode != 200 {
 		c.logger.Error("Failed to collect channel information from Twitch helix API", "err", channelResp.ErrorMessage)
-		return errors.New(channelResp.ErrorMessage)
+		return newAPIError(channelResp.ResponseCommon)
 	}
 
 	for _, channel := range channelResp.Data.Channels {
-		username := usersByID[channel.BroadcasterID]
-		ch <- c.channelInfo.mustNewConstMetric(1, username, channel.GameName, channel.Title, channel.BroadcasterLanguage)
-		ch <- c.channelDelaySeconds.mustNewConstMetric(float64(channel.Delay), username)
+		user := usersByID[channel.BroadcasterID]
+		ch <- c.channelInfo.mustNewChannelMetric(1, user, channel.GameName, channel.Title, channel.BroadcasterLanguage)
+		ch <- c.channelDelaySeconds.mustNewChannelMetric(float64(channel.Delay), user)
+		reportChannel(ctx, usernameLabel(user), user.ID, nil)
 	}
 
 	return nil
@@ -0,0 +1,23 @@
+package collector
+
+import "testing"
+
+func TestChannelInfo(t *testing.T) {
+	_, c := newTestCollector(t, "channel_info")
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_delay_seconds The stream delay in seconds for a channel.
+# TYPE twitch_channel_delay_seconds gauge
+twitch_channel_delay_seconds{user_id="1",username="dam0un"} 0
+# HELP twitch_channel_info Channel metadata including game, title and language.
+# TYPE twitch_channel_info gauge
+twitch_channel_info{game="Just Chatting",language="en",title="Building exporters",user_id="1",username="dam0un"} 1
+`)
+}
+
+func TestChannelInfoError(t *testing.T) {
+	s, c := newTestCollector(t, "channel_info")
+	s.Error("/channels", 500, "Internal Server Error")
+
+	expectUpdateError(t, c)
+}
@@ -0,0 +1,34 @@
+package collector
+
+import "testing"
+
+func TestChannelModeratorsTotal(t *testing.T) {
+	_, c := newTestCollector(t, "channel_moderators_total")
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_moderators_total The number of moderators of a channel.
+# TYPE twitch_channel_moderators_total gauge
+twitch_channel_moderators_total{user_id="1",username="dam0un"} 1
+`)
+}
+
+func TestChannelModeratorsTotalPaginated(t *testing.T) {
+	s, c := newTestCollector(t, "channel_moderators_total")
+	s.Respond("/moderation/moderators",
+		`{"data": [{"user_id": "2"}], "pagination": {"cursor": "1"}}`,
+		`{"data": [{"user_id": "3"}, {"user_id": "4"}], "pagination": {}}`,
+	)
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_moderators_total The number of moderators of a channel.
+# TYPE twitch_channel_moderators_total gauge
+twitch_channel_moderators_total{user_id="1",username="dam0un"} 3
+`)
+}
+
+func TestChannelModeratorsTotalError(t *testing.T) {
+	s, c := newTestCollector(t, "channel_moderators_total")
+	s.Error("/moderation/moderators", 401, "Missing scope: moderation:read")
+
+	expectUpdateError(t, c)
+}
@@ -1,8 +1,23 @@
 package collector
 
-import "fmt"
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
 
-// ChannelNames represents a list of twitch channels.
+	"github.com/nicklaw5/helix/v2"
+	"github.com/prometheus/common/model"
+)
+
+// channelIDPrefix marks the channels configured by broadcaster ID rather than
+// by login, e.g. "id:12345", which keep resolving when the channel is renamed.
+const channelIDPrefix = "id:"
+
+// ChannelNames represents a list of twitch channels, given by login or by
+// broadcaster ID prefixed with "id:".
 type ChannelNames []string
 
 // IsCumulative is required for kingpin interfaces to allow multiple values
@@ -20,3 +35,243 @@ func (c *ChannelNames) Set(v string) error {
 func (c ChannelNames) String() string {
 	return fmt.Sprintf("%v", []string(c))
 }
+
+// split returns the logins and the broadcaster IDs of the channels.
+func (c ChannelNames) split() (logins, ids []string) {
+	for _, channel := range c {
+		if id, ok := strings.CutPrefix(channel, channelIDPrefix); ok {
+			ids = append(ids, id)
+		} else {
+			logins = append(logins, channel)
+		}
+	}
+	return logins, ids
+}
+
+// Channels returns the channels without any label.
+func (c ChannelNames) Channels() Channels {
+	channels := make(Channels, 0, len(c))
+	for _, name := range c {
+		channels = append(channels, Channel{Name: name})
+	}
+	return channels
+}
+
+// reservedLabelPrefix is prepended to the channel labels named like a label
+// of the channel metrics, e.g. tier is exposed as channel_tier.
+const reservedLabelPrefix = "channel_"
+
+// variableLabels are the names of the variable labels of the channel metrics,
+// recorded as their descs are created.
+var variableLabels = struct {
+	mtx   sync.Mutex
+	names map[string]bool
+}{names: make(map[string]bool)}
+
+// describeOnce creates every collector once, so that the variable labels of
+// all the channel metrics are recorded.
+var describeOnce sync.Once
+
+// channelVariableLabels records names as the variable labels of a channel
+// metric and returns them.
+func channelVariableLabels(names ...string) []string {
+	variableLabels.mtx.Lock()
+	defer variableLabels.mtx.Unlock()
+
+	for _, name := range names {
+		variableLabels.names[name] = true
+	}
+	return names
+}
+
+// reservedLabelNames returns the variable labels of every channel metric,
+// which channel labels are renamed from.
+func reservedLabelNames() map[string]bool {
+	describeOnce.Do(func() {
+		logger := slog.New(slog.DiscardHandler)
+		for _, factory := range factories {
+			// collectors which can't be created without a client or an
+			// eventsub client record their labels before failing
+			_, _ = factory(logger, nil, nil, nil)
+		}
+		newChannelScrapeSuccessDesc(nil)
+		newChannelLoginInfoDesc(nil)
+	})
+
+	variableLabels.mtx.Lock()
+	defer variableLabels.mtx.Unlock()
+
+	return maps.Clone(variableLabels.names)
+}
+
+// exposedLabelName returns the name a channel label is exposed under.
+func exposedLabelName(name string, reserved map[string]bool) string {
+	if reserved[name] {
+		return reservedLabelPrefix + name
+	}
+	return name
+}
+
+// Channel is a channel to monitor, given by login or by broadcaster ID, along
+// with the labels added to all its metrics.
+type Channel struct {
+	Name   string
+	Labels map[string]string
+	// IncludeCollectors are run for the channel even if they are disabled,
+	// ExcludeCollectors are not run for the channel even if they are enabled.
+	IncludeCollectors []string
+	ExcludeCollectors []string
+}
+
+// runs returns whether the collector runs for the channel, enabled is
+// whether the collector is enabled for every channel.
+func (c Channel) runs(collector string, enabled bool) bool {
+	if slices.Contains(c.ExcludeCollectors, collector) {
+		return false
+	}
+	return enabled || slices.Contains(c.IncludeCollectors, collector)
+}
+
+// Channels represents a list of twitch channels with their labels.
+type Channels []Channel
+
+// Names returns the names of the channels.
+func (c Channels) Names() ChannelNames {
+	names := make(ChannelNames, 0, len(c))
+	for _, channel := range c {
+		names = append(names, channel.Name)
+	}
+	return names
+}
+
+// Equal returns whether c and o are the same channels with the same labels.
+func (c Channels) Equal(o Channels) bool {
+	return slices.EqualFunc(c, o, func(a, b Channel) bool {
+		return a.Name == b.Name && maps.Equal(a.Labels, b.Labels) &&
+			slices.Equal(a.IncludeCollectors, b.IncludeCollectors) && slices.Equal(a.ExcludeCollectors, b.ExcludeCollectors)
+	})
+}
+
+// Validate checks that the included and excluded collectors exist, that the
+// label names are valid and that every channel with labels has the same label
+// names, as all the series of a metric must have the same labels. Channels
+// without labels, e.g. discovered ones, get empty values. Labels named like a
+// label of the channel metrics are exposed with the channel_ prefix, which
+// must not clash with another label.
+func (c Channels) Validate() error {
+	reserved := reservedLabelNames()
+
+	var first *Channel
+	for i, channel := range c {
+		for _, name := range append(slices.Clone(channel.IncludeCollectors), channel.ExcludeCollectors...) {
+			if _, exist := collectorState[name]; !exist {
+				return fmt.Errorf("channel %s: missing collector: %s", channel.Name, name)
+			}
+		}
+
+		if len(channel.Labels) == 0 {
+			continue
+		}
+		exposed := make(map[string]string, len(channel.Labels))
+		for name := range channel.Labels {
+			if !model.LabelName(name).IsValid() || strings.HasPrefix(name, "__") {
+				return fmt.Errorf("channel %s: invalid label name %q", channel.Name, name)
+			}
+			as := exposedLabelName(name, reserved)
+			if reserved[as] {
+				return fmt.Errorf("channel %s: label name %q is reserved", channel.Name, name)
+			}
+			if other, ok := exposed[as]; ok {
+				return fmt.Errorf("channel %s: labels %q and %q are both exposed as %q", channel.Name, min(name, other), max(name, other), as)
+			}
+			exposed[as] = name
+		}
+
+		if first == nil {
+			first = &c[i]
+			continue
+		}
+		if !slices.Equal(slices.Sorted(maps.Keys(channel.Labels)), slices.Sorted(maps.Keys(first.Labels))) {
+			return fmt.Errorf("channel %s has labels %v while channel %s has labels %v, all channels must have the same labels",
+				channel.Name, slices.Sorted(maps.Keys(channel.Labels)), first.Name, slices.Sorted(maps.Keys(first.Labels)))
+		}
+	}
+	return nil
+}
+
+// lookup returns the channel with the given name, ignoring case.
+func (c Channels) lookup(name string) (Channel, bool) {
+	for _, channel := range c {
+		if strings.EqualFold(channel.Name, name) {
+			return channel, true
+		}
+	}
+	return Channel{}, false
+}
+
+// labelKeys returns the sorted names of the labels of the channels, as
+// configured.
+func (c Channels) labelKeys() []string {
+	for _, channel := range c {
+		if len(channel.Labels) > 0 {
+			return slices.Sorted(maps.Keys(channel.Labels))
+		}
+	}
+	return nil
+}
+
+// staticLabelNames returns the names the labels of the channels are exposed
+// under, in the order of labelKeys.
+func (c Channels) staticLabelNames() []string {
+	keys := c.labelKeys()
+	if len(keys) == 0 {
+		return nil
+	}
+
+	reserved := reservedLabelNames()
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, exposedLabelName(key, reserved))
+	}
+	return names
+}
+
+// labelNames returns the names of the labels identifying the channel of every
+// channel metric, followed by the names of the labels of the metric and by
+// the names of the channel labels.
+func (c Channels) labelNames(labels ...string) []string {
+	return append(channelVariableLabels(channelLabelNames(labels...)...), c.staticLabelNames()...)
+}
+
+// labelValues returns the values of the channel labels of user, in the order
+// of staticLabelNames. Channels configured with a previous login of user are
+// matched through the user cache.
+func (c Channels) labelValues(user helix.User) []string {
+	names := c.labelKeys()
+	if len(names) == 0 {
+		return nil
+	}
+
+	channel, _ := c.channelOf(user)
+
+	values := make([]string, 0, len(names))
+	for _, name := range names {
+		values = append(values, channel.Labels[name])
+	}
+	return values
+}
+
+// channelOf returns the channel resolving to user.
+func (c Channels) channelOf(user helix.User) (Channel, bool) {
+	for _, channel := range c {
+		if channel.Name == channelIDPrefix+user.ID || strings.EqualFold(channel.Name, user.Login) {
+			return channel, true
+		}
+	}
+	for _, channel := range c {
+		if id, ok := users.knownID(channel.Name); ok && id == user.ID {
+			return channel, true
+		}
+	}
+	return Channel{}, false
+}
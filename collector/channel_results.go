@@ -0,0 +1,252 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/nicklaw5/helix/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newChannelScrapeSuccessDesc returns the desc of the channel scrape success
+// metric, labelled with the channel labels of channels.
+func newChannelScrapeSuccessDesc(channels Channels) *prometheus.Desc {
+	return prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "channel", "scrape_success"),
+		"Whether a collector succeeded for a channel, error_class tells why it did not.",
+		append(channelVariableLabels("collector", "username", "user_id", "error_class"), channels.staticLabelNames()...),
+		nil,
+	)
+}
+
+// newChannelLoginInfoDesc returns the desc of the login info metric, labelled
+// with the channel labels of channels.
+func newChannelLoginInfoDesc(channels Channels) *prometheus.Desc {
+	return prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "channel", "login_info"),
+		"Current login and display name of a channel, the value is always 1.",
+		append(channelVariableLabels("user_id", "login", "display_name"), channels.staticLabelNames()...),
+		nil,
+	)
+}
+
+// errChannelNotFound is reported for channels which do not resolve to a user.
+var errChannelNotFound = errors.New("channel not found")
+
+// apiError is an error response of the Twitch API.
+type apiError struct {
+	status  int
+	message string
+}
+
+func newAPIError(resp helix.ResponseCommon) error {
+	return apiError{status: resp.StatusCode, message: resp.ErrorMessage}
+}
+
+func (e apiError) Error() string {
+	if e.message == "" {
+		return fmt.Sprintf("%d %s", e.status, http.StatusText(e.status))
+	}
+	return e.message
+}
+
+// errorClass returns a short description of the kind of err, used as the
+// error_class label.
+func errorClass(err error) string {
+	var apiErr apiError
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, errChannelNotFound):
+		return "not_found"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.status == http.StatusUnauthorized:
+			return "unauthorized"
+		case apiErr.status == http.StatusForbidden:
+			return "forbidden"
+		case apiErr.status == http.StatusNotFound:
+			return "not_found"
+		case apiErr.status == http.StatusTooManyRequests:
+			return "rate_limited"
+		case apiErr.status >= http.StatusInternalServerError:
+			return "server_error"
+		default:
+			return "bad_request"
+		}
+	default:
+		return "request_failed"
+	}
+}
+
+type channelResultsContextKey struct{}
+
+// channelResults records the outcome of a collector update for every channel,
+// so that a failing channel does not hide the metrics of the other ones.
+type channelResults struct {
+	// channels are the channels whose labels are added to the channel scrape
+	// success metrics.
+	channels Channels
+
+	mtx     sync.Mutex
+	classes map[channelKey]string
+	users   map[string]helix.User
+}
+
+// channelKey identifies a channel, userID is empty for channels which did not
+// resolve to a user.
+type channelKey struct {
+	username string
+	userID   string
+}
+
+// withChannelResults returns a context carrying new channel results for
+// channels.
+func withChannelResults(ctx context.Context, channels Channels) (context.Context, *channelResults) {
+	r := &channelResults{
+		channels: channels,
+		classes:  make(map[channelKey]string),
+		users:    make(map[string]helix.User),
+	}
+	return context.WithValue(ctx, channelResultsContextKey{}, r), r
+}
+
+// reportChannel records the outcome of the update of a channel, err being nil
+// when it succeeded.
+func reportChannel(ctx context.Context, username, userID string, err error) {
+	r, ok := ctx.Value(channelResultsContextKey{}).(*channelResults)
+	if !ok {
+		return
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.classes[channelKey{username: username, userID: userID}] = errorClass(err)
+}
+
+// reportUsers records the users the channels resolved to.
+func reportUsers(ctx context.Context, users []helix.User) {
+	r, ok := ctx.Value(channelResultsContextKey{}).(*channelResults)
+	if !ok {
+		return
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for _, user := range users {
+		r.users[user.ID] = user
+	}
+}
+
+// resolvedUsers returns the users reported by reportUsers.
+func (r *channelResults) resolvedUsers() []helix.User {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return uniqueUsers(r.users)
+}
+
+// loginInfoMetrics returns the login info metric of every user, without
+// duplicates, labelled with the channel labels of channels.
+func loginInfoMetrics(channels Channels, users []helix.User) []prometheus.Metric {
+	byID := make(map[string]helix.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+
+	desc := newChannelLoginInfoDesc(channels)
+	metrics := make([]prometheus.Metric, 0, len(byID))
+	for _, user := range byID {
+		values := append([]string{user.ID, strings.ToLower(user.Login), user.DisplayName}, channels.labelValues(user)...)
+		metrics = append(metrics, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, values...))
+	}
+	return metrics
+}
+
+// metrics returns the channel scrape success metrics of the collector.
+func (r *channelResults) metrics(collector string) []prometheus.Metric {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	desc := newChannelScrapeSuccessDesc(r.channels)
+	metrics := make([]prometheus.Metric, 0, len(r.classes))
+	for channel, class := range r.classes {
+		var success float64
+		if class == "" {
+			success = 1
+		}
+		// channels which did not resolve are reported under their configured
+		// name, matched as a login
+		user := helix.User{ID: channel.userID, Login: channel.username}
+		values := append([]string{collector, channel.username, channel.userID, class}, r.channels.labelValues(user)...)
+		metrics = append(metrics, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, success, values...))
+	}
+
+	return metrics
+}
+
+// updateChannels calls update for every user, carrying on past the channels
+// whose update failed. The collector update only fails when the update of
+// every channel failed, partial failures being reported per channel.
+func updateChannels(ctx context.Context, users []helix.User, update func(user helix.User) error) error {
+	var errs []error
+	for _, user := range users {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := update(user)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		reportChannel(ctx, usernameLabel(user), user.ID, err)
+	}
+
+	if len(errs) < len(users) {
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// getChannelUsers resolves the channels to Twitch users, reporting the
+// channels which do not resolve to any user, e.g. banned ones.
+func getChannelUsers(ctx context.Context, client HelixClient, logger *slog.Logger, channelNames ChannelNames) ([]helix.User, error) {
+	resolved, err := resolveChannels(client, logger, channelNames)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range channelNames {
+		if _, ok := resolved[name]; !ok {
+			logger.Warn("channel not found", "channel", name)
+			reportChannel(ctx, name, "", errChannelNotFound)
+		}
+	}
+
+	if len(resolved) == 0 {
+		return nil, errChannelNotFound
+	}
+
+	users := uniqueUsers(resolved)
+	reportUsers(ctx, users)
+	return users, nil
+}
+
+// userLogins returns the lowercase logins of the users.
+func userLogins(users []helix.User) []string {
+	logins := make([]string, 0, len(users))
+	for _, user := range users {
+		logins = append(logins, strings.ToLower(user.Login))
+	}
+	return logins
+}
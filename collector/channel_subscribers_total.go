@@ -1,7 +1,7 @@
 package collector
 
 import (
-	"errors"
+	"context"
 	"log/slog"
 
 	"github.com/damoun/twitch_exporter/internal/eventsub"
@@ -16,7 +16,7 @@ const (
 
 type channelSubscriberTotalCollector struct {
 	logger       *slog.Logger
-	client       *helix.Client
+	client       HelixClient
 	channelNames ChannelNames
 
 	channelSubscribersTotal   typedDesc
@@ -24,41 +24,41 @@ type channelSubscriberTotalCollector struct {
 }
 
 func init() {
-	registerCollector("channel_subscribers_total", defaultDisabled, NewChannelSubscriberTotalCollector)
+	registerCollector("channel_subscribers_total", defaultDisabled, 0, highPriority, userToken("channel:read:subscriptions"), NewChannelSubscriberTotalCollector)
 }
 
-func NewChannelSubscriberTotalCollector(logger *slog.Logger, client *helix.Client, _ *eventsub.Client, channelNames ChannelNames) (Collector, error) {
+func NewChannelSubscriberTotalCollector(logger *slog.Logger, client HelixClient, _ *eventsub.Client, channels Channels) (Collector, error) {
 	c := channelSubscriberTotalCollector{
 		logger:       logger,
 		client:       client,
-		channelNames: channelNames,
+		channelNames: channels.Names(),
 
 		channelSubscribersTotal: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_subscribers_total"),
 			"The number of subscriber of a channel.",
-			[]string{"username", "tier", "gifted"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames("tier", "gifted"), nil,
+		), prometheus.GaugeValue, channels},
 		channelSubscriptionPoints: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_subscription_points"),
 			"The number of subscription points of a channel.",
-			[]string{"username"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames(), nil,
+		), prometheus.GaugeValue, channels},
 	}
 
 	return c, nil
 }
 
-func (c channelSubscriberTotalCollector) Update(ch chan<- prometheus.Metric) error {
+func (c channelSubscriberTotalCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if len(c.channelNames) == 0 {
 		return ErrNoData
 	}
 
-	users, err := getUsers(c.client, c.logger, c.channelNames)
+	users, err := getChannelUsers(ctx, c.client, c.logger, c.channelNames)
 	if err != nil {
 		return err
 	}
 
-	for _, user := range users {
+	return updateChannels(ctx, users, func(user helix.User) error {
 		subscriptionsResp, err := c.client.GetSubscriptions(&helix.SubscriptionsParams{
 			BroadcasterID: user.ID,
 		})
@@ -70,7 +70,7 @@ func (c channelSubscriberTotalCollector) Update(ch chan<- prometheus.Metric) err
 
 		if subscriptionsResp.StatusCode != 200 {
 			c.logger.Error("Failed to collect subscribers stats from Twitch helix API", "err", subscriptionsResp.ErrorMessage)
-			return errors.New(subscriptionsResp.ErrorMessage)
+			return newAPIError(subscriptionsResp.ResponseCommon)
 		}
 
 		subCounter := make(map[string]int)
@@ -91,15 +91,15 @@ func (c channelSubscriberTotalCollector) Update(ch chan<- prometheus.Metric) err
 		}
 
 		for tier, counter := range giftedSubCounter {
-			ch <- c.channelSubscribersTotal.mustNewConstMetric(float64(counter), user.DisplayName, tier, giftedSub)
+			ch <- c.channelSubscribersTotal.mustNewChannelMetric(float64(counter), user, tier, giftedSub)
 		}
 
 		for tier, counter := range subCounter {
-			ch <- c.channelSubscribersTotal.mustNewConstMetric(float64(counter), user.DisplayName, tier, notGiftedSub)
+			ch <- c.channelSubscribersTotal.mustNewChannelMetric(float64(counter), user, tier, notGiftedSub)
 		}
 
-		ch <- c.channelSubscriptionPoints.mustNewConstMetric(float64(subscriptionsResp.Data.Points), user.DisplayName)
-	}
+		ch <- c.channelSubscriptionPoints.mustNewChannelMetric(float64(subscriptionsResp.Data.Points), user)
 
-	return nil
+		return nil
+	})
 }
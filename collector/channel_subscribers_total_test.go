@@ -0,0 +1,25 @@
+package collector
+
+import "testing"
+
+func TestChannelSubscribersTotal(t *testing.T) {
+	_, c := newTestCollector(t, "channel_subscribers_total")
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_subscribers_total The number of subscriber of a channel.
+# TYPE twitch_channel_subscribers_total gauge
+twitch_channel_subscribers_total{gifted="false",tier="1000",user_id="1",username="dam0un"} 1
+twitch_channel_subscribers_total{gifted="false",tier="3000",user_id="1",username="dam0un"} 1
+twitch_channel_subscribers_total{gifted="true",tier="1000",user_id="1",username="dam0un"} 1
+# HELP twitch_channel_subscription_points The number of subscription points of a channel.
+# TYPE twitch_channel_subscription_points gauge
+twitch_channel_subscription_points{user_id="1",username="dam0un"} 8
+`)
+}
+
+func TestChannelSubscribersTotalError(t *testing.T) {
+	s, c := newTestCollector(t, "channel_subscribers_total")
+	s.Error("/subscriptions", 401, "Missing scope: channel:read:subscriptions")
+
+	expectUpdateError(t, c)
+}
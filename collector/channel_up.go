@@ -1,69 +1,68 @@
 package collector
 
 import (
+	"context"
 	"log/slog"
+	"strings"
 
 	"github.com/damoun/twitch_exporter/internal/eventsub"
-	"github.com/nicklaw5/helix/v2"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 type channelUpCollector struct {
 	logger       *slog.Logger
-	client       *helix.Client
+	client       HelixClient
 	channelNames ChannelNames
 
 	channelUp typedDesc
 }
 
 func init() {
-	registerCollector("channel_up", defaultEnabled, NewChannelUpCollector)
+	registerCollector("channel_up", defaultEnabled, 0, highPriority, anyToken, NewChannelUpCollector)
 }
 
-func NewChannelUpCollector(logger *slog.Logger, client *helix.Client, _ *eventsub.Client, channelNames ChannelNames) (Collector, error) {
+func NewChannelUpCollector(logger *slog.Logger, client HelixClient, _ *eventsub.Client, channels Channels) (Collector, error) {
 	c := channelUpCollector{
 		logger:       logger,
 		client:       client,
-		channelNames: channelNames,
+		channelNames: channels.Names(),
 
 		channelUp: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_up"),
 			"Is the channel live.",
-			[]string{"username", "game"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames("game"), nil,
+		), prometheus.GaugeValue, channels},
 	}
 
 	return c, nil
 }
 
-func (c channelUpCollector) Update(ch chan<- prometheus.Metric) error {
+func (c channelUpCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if len(c.channelNames) == 0 {
 		return ErrNoData
 	}
 
-	streamsResp, err := c.client.GetStreams(&helix.StreamsParams{
-		UserLogins: c.channelNames,
-		First:      len(c.channelNames),
-	})
+	users, err := getChannelUsers(ctx, c.client, c.logger, c.channelNames)
+	if err != nil {
+		return err
+	}
 
+	streams, err := getStreams(ctx, c.client, c.logger, userLogins(users))
 	if err != nil {
-		c.logger.Error("could not get streams", "err", err)
 		return err
 	}
 
-	for _, n := range c.channelNames {
+	for _, user := range users {
 		state := 0
 		game := ""
 
-		for _, s := range streamsResp.Data.Streams {
-			if s.UserName == n {
-				state = 1
-				game = s.GameName
-				break
-			}
+		if s, ok := streams[strings.ToLower(user.Login)]; ok {
+			state = 1
+			game = s.GameName
 		}
 
-		ch <- c.channelUp.mustNewConstMetric(float64(state), n, game)
+		ch <- c.channelUp.mustNewLoginMetric(float64(state), user, game)
+		reportChannel(ctx, loginLabel(user), user.ID, nil)
 	}
 
 	return nil
@@ -0,0 +1,31 @@
+package collector
+
+import "testing"
+
+func TestChannelUp(t *testing.T) {
+	_, c := newTestCollector(t, "channel_up")
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_up Is the channel live.
+# TYPE twitch_channel_up gauge
+twitch_channel_up{game="Just Chatting",user_id="1",username="dam0un"} 1
+`)
+}
+
+func TestChannelUpOffline(t *testing.T) {
+	s, c := newTestCollector(t, "channel_up")
+	s.Respond("/streams", `{"data": [], "pagination": {}}`)
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_up Is the channel live.
+# TYPE twitch_channel_up gauge
+twitch_channel_up{game="",user_id="1",username="dam0un"} 0
+`)
+}
+
+func TestChannelUpError(t *testing.T) {
+	s, c := newTestCollector(t, "channel_up")
+	s.Error("/streams", 500, "Internal Server Error")
+
+	expectUpdateError(t, c)
+}
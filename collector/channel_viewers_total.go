@@ -1,58 +1,62 @@
 package collector
 
 import (
+	"context"
 	"log/slog"
+	"strings"
 
 	"github.com/damoun/twitch_exporter/internal/eventsub"
-	"github.com/nicklaw5/helix/v2"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 type channelViewersTotalCollector struct {
 	logger       *slog.Logger
-	client       *helix.Client
+	client       HelixClient
 	channelNames ChannelNames
 
 	channelViewersTotal typedDesc
 }
 
 func init() {
-	registerCollector("channel_viewers_total", defaultEnabled, NewChannelViewersTotalCollector)
+	registerCollector("channel_viewers_total", defaultEnabled, 0, highPriority, anyToken, NewChannelViewersTotalCollector)
 }
 
-func NewChannelViewersTotalCollector(logger *slog.Logger, client *helix.Client, _ *eventsub.Client, channelNames ChannelNames) (Collector, error) {
+func NewChannelViewersTotalCollector(logger *slog.Logger, client HelixClient, _ *eventsub.Client, channels Channels) (Collector, error) {
 	c := channelViewersTotalCollector{
 		logger:       logger,
 		client:       client,
-		channelNames: channelNames,
+		channelNames: channels.Names(),
 
 		channelViewersTotal: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_viewers_total"),
 			"How many viewers on this live channel. If stream is offline then this is absent.",
-			[]string{"username", "game"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames("game"), nil,
+		), prometheus.GaugeValue, channels},
 	}
 
 	return c, nil
 }
 
-func (c channelViewersTotalCollector) Update(ch chan<- prometheus.Metric) error {
+func (c channelViewersTotalCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if len(c.channelNames) == 0 {
 		return ErrNoData
 	}
 
-	streamsResp, err := c.client.GetStreams(&helix.StreamsParams{
-		UserLogins: c.channelNames,
-		First:      len(c.channelNames),
-	})
+	users, err := getChannelUsers(ctx, c.client, c.logger, c.channelNames)
+	if err != nil {
+		return err
+	}
 
+	streams, err := getStreams(ctx, c.client, c.logger, userLogins(users))
 	if err != nil {
-		c.logger.Error("could not get streams", "err", err)
 		return err
 	}
 
-	for _, s := range streamsResp.Data.Streams {
-		ch <- c.channelViewersTotal.mustNewConstMetric(float64(s.ViewerCount), s.UserName, s.GameName)
+	for _, user := range users {
+		if s, ok := streams[strings.ToLower(user.Login)]; ok {
+			ch <- c.channelViewersTotal.mustNewChannelMetric(float64(s.ViewerCount), user, s.GameName)
+		}
+		reportChannel(ctx, usernameLabel(user), user.ID, nil)
 	}
 
 	return nil
@@ -0,0 +1,20 @@
+package collector
+
+import "testing"
+
+func TestChannelViewersTotal(t *testing.T) {
+	_, c := newTestCollector(t, "channel_viewers_total")
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_viewers_total How many viewers on this live channel. If stream is offline then this is absent.
+# TYPE twitch_channel_viewers_total gauge
+twitch_channel_viewers_total{game="Just Chatting",user_id="1",username="dam0un"} 42
+`)
+}
+
+func TestChannelViewersTotalError(t *testing.T) {
+	s, c := newTestCollector(t, "channel_viewers_total")
+	s.Error("/streams", 500, "Internal Server Error")
+
+	expectUpdateError(t, c)
+}
@@ -1,8 +1,9 @@
 package collector
 
 import (
-	"errors"
+	"context"
 	"log/slog"
+	"time"
 
 	"github.com/damoun/twitch_exporter/internal/eventsub"
 	"github.com/nicklaw5/helix/v2"
@@ -11,44 +12,44 @@ import (
 
 type channelVipsTotalCollector struct {
 	logger       *slog.Logger
-	client       *helix.Client
+	client       HelixClient
 	channelNames ChannelNames
 
 	channelVipsTotal typedDesc
 }
 
 func init() {
-	registerCollector("channel_vips_total", defaultDisabled, NewChannelVipsTotalCollector)
+	registerCollector("channel_vips_total", defaultDisabled, 5*time.Minute, lowPriority, userToken("channel:read:vips"), NewChannelVipsTotalCollector)
 }
 
-func NewChannelVipsTotalCollector(logger *slog.Logger, client *helix.Client, _ *eventsub.Client, channelNames ChannelNames) (Collector, error) {
+func NewChannelVipsTotalCollector(logger *slog.Logger, client HelixClient, _ *eventsub.Client, channels Channels) (Collector, error) {
 	c := channelVipsTotalCollector{
 		logger:       logger,
 		client:       client,
-		channelNames: channelNames,
+		channelNames: channels.Names(),
 
 		channelVipsTotal: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "channel_vips_total"),
 			"The number of VIPs of a channel.",
-			[]string{"username"}, nil,
-		), prometheus.GaugeValue},
+			channels.labelNames(), nil,
+		), prometheus.GaugeValue, channels},
 	}
 
 	return c, nil
 }
 
-func (c channelVipsTotalCollector) Update(ch chan<- prometheus.Metric) error {
+func (c channelVipsTotalCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if len(c.channelNames) == 0 {
 		return ErrNoData
 	}
 
-	users, err := getUsers(c.client, c.logger, c.channelNames)
+	users, err := getChannelUsers(ctx, c.client, c.logger, c.channelNames)
 	if err != nil {
 		return err
 	}
 
-	for _, user := range users {
-		total, err := countPaginated(func(cursor string) (int, string, error) {
+	return updateChannels(ctx, users, func(user helix.User) error {
+		total, err := countPaginated(ctx, func(cursor string) (int, string, error) {
 			resp, err := c.client.GetChannelVips(&helix.GetChannelVipsParams{
 				BroadcasterID: user.ID,
 				First:         100,
@@ -60,7 +61,7 @@ func (c channelVipsTotalCollector) Update(ch chan<- prometheus.Metric) error {
 			}
 			if resp.StatusCode != 200 {
 				c.logger.Error("Failed to collect VIPs from Twitch helix API", "err", resp.ErrorMessage)
-				return 0, "", errors.New(resp.ErrorMessage)
+				return 0, "", newAPIError(resp.ResponseCommon)
 			}
 			return len(resp.Data.ChannelsVips), resp.Data.Pagination.Cursor, nil
 		})
@@ -68,8 +69,8 @@ func (c channelVipsTotalCollector) Update(ch chan<- prometheus.Metric) error {
 			return err
 		}
 
-		ch <- c.channelVipsTotal.mustNewConstMetric(float64(total), user.DisplayName)
-	}
+		ch <- c.channelVipsTotal.mustNewChannelMetric(float64(total), user)
 
-	return nil
+		return nil
+	})
 }
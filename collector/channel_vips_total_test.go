@@ -0,0 +1,34 @@
+package collector
+
+import "testing"
+
+func TestChannelVipsTotal(t *testing.T) {
+	_, c := newTestCollector(t, "channel_vips_total")
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_vips_total The number of VIPs of a channel.
+# TYPE twitch_channel_vips_total gauge
+twitch_channel_vips_total{user_id="1",username="dam0un"} 1
+`)
+}
+
+func TestChannelVipsTotalPaginated(t *testing.T) {
+	s, c := newTestCollector(t, "channel_vips_total")
+	s.Respond("/channels/vips",
+		`{"data": [{"user_id": "2"}, {"user_id": "3"}], "pagination": {"cursor": "1"}}`,
+		`{"data": [{"user_id": "4"}, {"user_id": "5"}], "pagination": {}}`,
+	)
+
+	expectMetrics(t, c, `
+# HELP twitch_channel_vips_total The number of VIPs of a channel.
+# TYPE twitch_channel_vips_total gauge
+twitch_channel_vips_total{user_id="1",username="dam0un"} 4
+`)
+}
+
+func TestChannelVipsTotalError(t *testing.T) {
+	s, c := newTestCollector(t, "channel_vips_total")
+	s.Error("/channels/vips", 401, "Missing scope: channel:read:vips")
+
+	expectUpdateError(t, c)
+}
@@ -0,0 +1,166 @@
+package collector
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/nicklaw5/helix/v2"
+)
+
+// ClientRouter is a HelixClient sending the requests of a broadcaster to the
+// client authenticated with the token of that broadcaster, and every other
+// request to its default client. Broadcasters are identified by the channel
+// their token is configured for, which is resolved through the user cache.
+type ClientRouter struct {
+	HelixClient
+
+	logger       *slog.Logger
+	broadcasters map[string]HelixClient
+}
+
+var _ HelixClient = (*ClientRouter)(nil)
+
+// NewClientRouter creates a router sending the requests to client, other than
+// the requests of the broadcasters of broadcasters, keyed by channel, which
+// are sent to their own client.
+func NewClientRouter(logger *slog.Logger, client HelixClient, broadcasters map[string]HelixClient) *ClientRouter {
+	return &ClientRouter{
+		HelixClient:  client,
+		logger:       logger,
+		broadcasters: broadcasters,
+	}
+}
+
+// Broadcaster returns the channel of the broadcaster token the requests of
+// channel are sent with, ok is false when they are sent with the default
+// client.
+func (r *ClientRouter) Broadcaster(channel string) (string, bool) {
+	for _, broadcaster := range slices.Sorted(maps.Keys(r.broadcasters)) {
+		if strings.EqualFold(broadcaster, channel) {
+			return broadcaster, true
+		}
+	}
+
+	resolved, err := resolveChannels(r.HelixClient, r.logger, ChannelNames{channel})
+	if err != nil {
+		r.logger.Warn("channel unknown, assuming it has no broadcaster token", "channel", channel, "err", err)
+		return "", false
+	}
+	user, ok := resolved[channel]
+	if !ok {
+		return "", false
+	}
+	broadcaster, _, ok := r.broadcasterOf(user.ID)
+	return broadcaster, ok
+}
+
+// broadcasterOf returns the channel and the client of the broadcaster token
+// of the user with the given ID.
+func (r *ClientRouter) broadcasterOf(userID string) (string, HelixClient, bool) {
+	broadcasters := slices.Sorted(maps.Keys(r.broadcasters))
+	resolved, err := resolveChannels(r.HelixClient, r.logger, broadcasters)
+	if err != nil {
+		r.logger.Warn("broadcaster channels unknown, sending the request with the default client", "broadcaster_id", userID, "err", err)
+		return "", nil, false
+	}
+
+	for _, broadcaster := range broadcasters {
+		if user, ok := resolved[broadcaster]; ok && user.ID == userID {
+			return broadcaster, r.broadcasters[broadcaster], true
+		}
+	}
+	return "", nil, false
+}
+
+// clientFor returns the client of the broadcaster, or the default client if
+// the broadcaster has no client of its own.
+func (r *ClientRouter) clientFor(broadcasterID string) (HelixClient, bool) {
+	if _, client, ok := r.broadcasterOf(broadcasterID); ok {
+		return client, true
+	}
+	return r.HelixClient, false
+}
+
+// clients returns the default client followed by the client of every
+// broadcaster.
+func (r *ClientRouter) clients() []HelixClient {
+	clients := []HelixClient{r.HelixClient}
+	for _, channel := range slices.Sorted(maps.Keys(r.broadcasters)) {
+		clients = append(clients, r.broadcasters[channel])
+	}
+	return clients
+}
+
+// tokenClients returns every client of client with its own token, so that
+// the collectors requesting the data of the token owner cover every
+// broadcaster of a ClientRouter.
+func tokenClients(client HelixClient) []HelixClient {
+	if r, ok := client.(*ClientRouter); ok {
+		return r.clients()
+	}
+	return []HelixClient{client}
+}
+
+func (r *ClientRouter) GetChannelFollows(params *helix.GetChannelFollowsParams) (*helix.GetChannelFollowersResponse, error) {
+	client, _ := r.clientFor(params.BroadcasterID)
+	return client.GetChannelFollows(params)
+}
+
+func (r *ClientRouter) GetChannelEmotes(params *helix.GetChannelEmotesParams) (*helix.GetChannelEmotesResponse, error) {
+	client, _ := r.clientFor(params.BroadcasterID)
+	return client.GetChannelEmotes(params)
+}
+
+func (r *ClientRouter) GetClips(params *helix.ClipsParams) (*helix.ClipsResponse, error) {
+	client, _ := r.clientFor(params.BroadcasterID)
+	return client.GetClips(params)
+}
+
+func (r *ClientRouter) GetChatSettings(params *helix.GetChatSettingsParams) (*helix.GetChatSettingsResponse, error) {
+	client, _ := r.clientFor(params.BroadcasterID)
+	return client.GetChatSettings(params)
+}
+
+// GetChannelChatChatters requests the chatters of a broadcaster with its own
+// token as the broadcaster, who is a moderator of its channel.
+func (r *ClientRouter) GetChannelChatChatters(params *helix.GetChatChattersParams) (*helix.GetChatChattersResponse, error) {
+	client, ok := r.clientFor(params.BroadcasterID)
+	if ok {
+		p := *params
+		p.ModeratorID = params.BroadcasterID
+		params = &p
+	}
+	return client.GetChannelChatChatters(params)
+}
+
+func (r *ClientRouter) GetModerators(params *helix.GetModeratorsParams) (*helix.ModeratorsResponse, error) {
+	client, _ := r.clientFor(params.BroadcasterID)
+	return client.GetModerators(params)
+}
+
+func (r *ClientRouter) GetChannelVips(params *helix.GetChannelVipsParams) (*helix.ChannelVipsResponse, error) {
+	client, _ := r.clientFor(params.BroadcasterID)
+	return client.GetChannelVips(params)
+}
+
+func (r *ClientRouter) GetBannedUsers(params *helix.BannedUsersParams) (*helix.BannedUsersResponse, error) {
+	client, _ := r.clientFor(params.BroadcasterID)
+	return client.GetBannedUsers(params)
+}
+
+func (r *ClientRouter) GetSubscriptions(params *helix.SubscriptionsParams) (*helix.SubscriptionsResponse, error) {
+	client, _ := r.clientFor(params.BroadcasterID)
+	return client.GetSubscriptions(params)
+}
+
+func (r *ClientRouter) GetCreatorGoals(params *helix.GetCreatorGoalsParams) (*helix.CreatorGoalsResponse, error) {
+	client, _ := r.clientFor(params.BroadcasterID)
+	return client.GetCreatorGoals(params)
+}
+
+func (r *ClientRouter) GetCharityCampaigns(params *helix.CharityCampaignsParams) (*helix.CharityCampaignsResponse, error) {
+	client, _ := r.clientFor(params.BroadcasterID)
+	return client.GetCharityCampaigns(params)
+}
@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/damoun/twitch_exporter/internal/helixtest"
+	"github.com/nicklaw5/helix/v2"
+	"github.com/prometheus/common/promslog"
+)
+
+const surdaftUser = `{"data": [{
+	"id": "2", "login": "surdaft", "display_name": "surdaft",
+	"type": "", "broadcaster_type": "partner",
+	"created_at": "2017-01-01T00:00:00Z"
+}]}`
+
+// newTestRouter returns the fake helix servers of the default client and of
+// the token of the surdaft broadcaster, along with a router between them.
+func newTestRouter(t *testing.T) (*helixtest.Server, *helixtest.Server, *ClientRouter) {
+	t.Helper()
+
+	s, client := newTestClient(t)
+	s.Respond("/users?login=surdaft", surdaftUser)
+
+	broadcaster := helixtest.NewServer()
+	t.Cleanup(broadcaster.Close)
+	broadcaster.Respond("/users", surdaftUser)
+	broadcasterClient, err := broadcaster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := NewClientRouter(promslog.NewNopLogger(), client, map[string]HelixClient{"surdaft": broadcasterClient})
+	return s, broadcaster, router
+}
+
+func TestClientRouterRoutesByConfiguredChannel(t *testing.T) {
+	s, broadcaster, router := newTestRouter(t)
+
+	if _, err := router.GetClips(&helix.ClipsParams{BroadcasterID: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := router.GetClips(&helix.ClipsParams{BroadcasterID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := broadcaster.Requests("/clips"); n != 1 {
+		t.Errorf("expected 1 clips request with the broadcaster token, got %d", n)
+	}
+	if n := s.Requests("/clips"); n != 1 {
+		t.Errorf("expected 1 clips request with the default token, got %d", n)
+	}
+
+	for channel, expected := range map[string]string{"Surdaft": "surdaft", "id:2": "surdaft", "dam0un": ""} {
+		if got, _ := router.Broadcaster(channel); got != expected {
+			t.Errorf("expected channel %s to be routed to %q, got %q", channel, expected, got)
+		}
+	}
+}
+
+func TestClientRouterFallsBackOnLookupFailure(t *testing.T) {
+	s, broadcaster, router := newTestRouter(t)
+	s.Error("/users?login=surdaft", 500, "Internal Server Error")
+
+	if _, err := router.GetClips(&helix.ClipsParams{BroadcasterID: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := broadcaster.Requests("/clips"); n != 0 {
+		t.Errorf("expected the request to fall back to the default token, got %d broadcaster requests", n)
+	}
+}
+
+func TestChannelBitsLeaderboardOnlyConfiguredChannels(t *testing.T) {
+	_, broadcaster, router := newTestRouter(t)
+
+	c, err := NewChannelBitsLeaderboardCollector(promslog.NewNopLogger(), router, nil, ChannelNames{"dam0un"}.Channels())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectMetrics(t, testCollector{c, t}, `
+# HELP twitch_channel_bits_leaderboard The bits leaderboard score for users on a channel.
+# TYPE twitch_channel_bits_leaderboard gauge
+twitch_channel_bits_leaderboard{broadcaster_id="1",rank="1",user_id="2",user_name="surdaft",username="dam0un"} 500
+twitch_channel_bits_leaderboard{broadcaster_id="1",rank="2",user_id="3",user_name="spammer",username="dam0un"} 100
+`)
+	if n := broadcaster.Requests("/bits/leaderboard"); n != 0 {
+		t.Errorf("expected no leaderboard request for the unconfigured broadcaster, got %d", n)
+	}
+}
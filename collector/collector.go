@@ -4,9 +4,13 @@
 package collector
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -31,6 +35,24 @@ var (
 		[]string{"collector"},
 		nil,
 	)
+	scrapeFailureDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "collector_failure"),
+		"Reason of the failure of a collector, only exposed when it failed.",
+		[]string{"collector", "reason"},
+		nil,
+	)
+	scrapeCacheAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "collector_cache_age_seconds"),
+		"Age of the metrics served for a collector.",
+		[]string{"collector"},
+		nil,
+	)
+	scrapeLastUpdateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "collector_last_update_timestamp_seconds"),
+		"Unix timestamp of the last update of a collector.",
+		[]string{"collector"},
+		nil,
+	)
 )
 
 const (
@@ -38,15 +60,129 @@ const (
 	defaultDisabled = false
 )
 
+// collectorPriority decides whether a collector keeps being updated when the
+// rate limit budget of the Twitch API is nearly exhausted.
+type collectorPriority int
+
+const (
+	highPriority collectorPriority = iota
+	lowPriority
+)
+
+// reasons exposed by scrapeFailureDesc
+const (
+	failureReasonError       = "error"
+	failureReasonNoData      = "no_data"
+	failureReasonTimeout     = "timeout"
+	failureReasonRateLimited = "rate_limited"
+)
+
+var (
+	collectorTimeout = kingpin.Flag("collector.timeout",
+		"Maximum duration of a collector update, it is also bounded by the scrape timeout sent by Prometheus. When 0, only the scrape timeout applies.").
+		Default("0s").Duration()
+	rateLimitReserve = kingpin.Flag("twitch.ratelimit-reserve",
+		"Number of Twitch API rate limit points reserved for high priority collectors, low priority collectors are paused while fewer points remain.").
+		Default("100").Int()
+	legacyUsernameLabel = kingpin.Flag("collector.legacy-username-label",
+		"Restore the channel labels of the collectors before the user_id label: no user_id, and the display name of channels as username label where they used it rather than their login.").
+		Default("false").Bool()
+)
+
+// RateLimiter reports the rate limit budget of the token used by the
+// collectors.
+type RateLimiter interface {
+	// RateLimitRemaining returns the remaining rate limit points and when
+	// they are refilled, ok is false while they are unknown.
+	RateLimitRemaining() (remaining int, reset time.Time, ok bool)
+}
+
+// RateLimiters is a RateLimiter tracking the budget of several tokens, each
+// with its own rate limit bucket, e.g. the default token and the broadcaster
+// tokens of a ClientRouter. It reports the lowest budget not refilled yet, as
+// collectors request the API with every token.
+type RateLimiters []RateLimiter
+
+// RateLimitRemaining implements RateLimiter.
+func (l RateLimiters) RateLimitRemaining() (remaining int, reset time.Time, ok bool) {
+	now := time.Now()
+	for _, limiter := range l {
+		r, rs, known := limiter.RateLimitRemaining()
+		if !known || !now.Before(rs) {
+			continue
+		}
+		if !ok || r < remaining {
+			remaining, reset, ok = r, rs, true
+		}
+	}
+	return remaining, reset, ok
+}
+
 var (
-	factories              = make(map[string]func(logger *slog.Logger, client *helix.Client, eventsubClient *eventsub.Client, channelNames ChannelNames) (Collector, error))
-	initiatedCollectorsMtx = sync.Mutex{}
-	initiatedCollectors    = make(map[string]Collector)
-	collectorState         = make(map[string]*bool)
-	forcedCollectors       = map[string]bool{} // collectors which have been explicitly enabled or disabled
+	factories           = make(map[string]func(logger *slog.Logger, client HelixClient, eventsubClient *eventsub.Client, channels Channels) (Collector, error))
+	collectorState      = make(map[string]*bool)
+	collectorIntervals  = make(map[string]*time.Duration)
+	collectorPriorities = make(map[string]collectorPriority)
+	collectorTokens     = make(map[string]TokenRequirement)
+	forcedCollectors    = map[string]bool{} // collectors which have been explicitly enabled or disabled
 )
 
-func registerCollector(collector string, isDefaultEnabled bool, factory func(logger *slog.Logger, client *helix.Client, eventsubClient *eventsub.Client, channelNames ChannelNames) (Collector, error)) {
+// eventDrivenCollectors count the events the process receives rather than
+// requesting the Twitch API. Their event handlers and subscriptions are shared
+// by the whole process, so they only run in the main exporter and are never
+// probed.
+var eventDrivenCollectors = make(map[string]bool)
+
+// TokenRequirement is the token a collector requires to request its data.
+type TokenRequirement struct {
+	// User is true when a user access token is required, any token is
+	// accepted otherwise.
+	User bool
+	// Scopes are the OAuth scopes the user access token must be granted.
+	Scopes []string
+}
+
+// anyToken is the requirement of the collectors requesting public data.
+var anyToken = TokenRequirement{}
+
+// userToken is the requirement of the collectors requesting private data with
+// a user access token granted scopes.
+func userToken(scopes ...string) TokenRequirement {
+	return TokenRequirement{User: true, Scopes: scopes}
+}
+
+// CollectorToken is the token required by a collector, along with the
+// channels it runs for.
+type CollectorToken struct {
+	Collector string
+	TokenRequirement
+	Channels Channels
+}
+
+// RequiredTokens returns the tokens required by the collectors run with cfg,
+// sorted by collector.
+func RequiredTokens(cfg Config) []CollectorToken {
+	var tokens []CollectorToken
+	for _, name := range slices.Sorted(maps.Keys(collectorState)) {
+		if channels, ok := cfg.channels(name); ok {
+			tokens = append(tokens, CollectorToken{Collector: name, TokenRequirement: collectorTokens[name], Channels: channels})
+		}
+	}
+	return tokens
+}
+
+// RequiredScopes returns the OAuth scopes of the user token required by the
+// collectors run with cfg, sorted and without duplicates.
+func RequiredScopes(cfg Config) []string {
+	var scopes []string
+	for _, token := range RequiredTokens(cfg) {
+		scopes = append(scopes, token.Scopes...)
+	}
+	slices.Sort(scopes)
+	return slices.Compact(scopes)
+}
+
+func registerCollector(collector string, isDefaultEnabled bool, defaultInterval time.Duration, priority collectorPriority, token TokenRequirement, factory func(logger *slog.Logger, client HelixClient, eventsubClient *eventsub.Client, channels Channels) (Collector, error)) {
 	var helpDefaultState string
 	if isDefaultEnabled {
 		helpDefaultState = "enabled"
@@ -61,12 +197,97 @@ func registerCollector(collector string, isDefaultEnabled bool, factory func(log
 	flag := kingpin.Flag(flagName, flagHelp).Default(defaultValue).Action(collectorFlagAction(collector)).Bool()
 	collectorState[collector] = flag
 
+	intervalFlagName := "collector." + collector + ".interval"
+	intervalFlagHelp := fmt.Sprintf("Minimum interval between two updates of the %s collector, cached metrics are served in between.", collector)
+	collectorIntervals[collector] = kingpin.Flag(intervalFlagName, intervalFlagHelp).Default(defaultInterval.String()).Duration()
+
+	collectorPriorities[collector] = priority
+	collectorTokens[collector] = token
 	factories[collector] = factory
 }
 
 type Exporter struct {
-	Collectors map[string]Collector
-	logger     *slog.Logger
+	logger         *slog.Logger
+	client         HelixClient
+	eventsubClient *eventsub.Client
+	filters        map[string]bool
+
+	// config and the collectors created from it are replaced together by
+	// ApplyConfig, so that a scrape never mixes two configurations.
+	mtx        sync.RWMutex
+	config     Config
+	collectors map[string]Collector
+	// generation is incremented by ApplyConfig, results of collectors of a
+	// previous generation are discarded.
+	generation uint64
+
+	// snapshots holds the last result of every collector, which is served
+	// until the collector interval elapses or, while the exporter is polling
+	// in the background, until the next poll.
+	snapshotsMtx sync.RWMutex
+	snapshots    map[string]snapshot
+	stopPolling  chan struct{}
+	pollInterval time.Duration
+
+	rateLimiter RateLimiter
+}
+
+// Config is the part of the configuration of an exporter which can be changed
+// while it is running.
+type Config struct {
+	Channels Channels
+	// Collectors overrides the --collector.<name> flags.
+	Collectors map[string]CollectorConfig
+}
+
+// CollectorConfig overrides the flags of a single collector, zero values keep
+// the flag value.
+type CollectorConfig struct {
+	Enabled  *bool
+	Interval time.Duration
+}
+
+// enabled returns whether the collector is enabled by the configuration, or
+// by its flag otherwise.
+func (c Config) enabled(name string) bool {
+	if cc, ok := c.Collectors[name]; ok && cc.Enabled != nil {
+		return *cc.Enabled
+	}
+	return *collectorState[name]
+}
+
+// interval returns the minimum interval between two updates of the collector.
+func (c Config) interval(name string) time.Duration {
+	if cc, ok := c.Collectors[name]; ok && cc.Interval > 0 {
+		return cc.Interval
+	}
+	if interval, ok := collectorIntervals[name]; ok {
+		return *interval
+	}
+	return 0
+}
+
+// channels returns the channels the collector runs for, and whether it runs
+// at all. Enabled collectors run for every channel which does not exclude
+// them, disabled ones only for the channels including them.
+func (c Config) channels(name string) (Channels, bool) {
+	enabled := c.enabled(name)
+
+	var channels Channels
+	for _, channel := range c.Channels {
+		if channel.runs(name, enabled) {
+			channels = append(channels, channel)
+		}
+	}
+	return channels, enabled || len(channels) > 0
+}
+
+// unchanged returns whether the collector runs for the same channels at the
+// same interval in c and o, so that its results remain valid.
+func (c Config) unchanged(o Config, name string) bool {
+	channels, _ := c.channels(name)
+	other, _ := o.channels(name)
+	return channels.Equal(other) && c.interval(name) == o.interval(name)
 }
 
 // Describe describes all the metrics ever exported by the Twitch exporter. It
@@ -74,6 +295,14 @@ type Exporter struct {
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- scrapeDurationDesc
 	ch <- scrapeSuccessDesc
+	ch <- scrapeFailureDesc
+	ch <- scrapeCacheAgeDesc
+	ch <- scrapeLastUpdateDesc
+	_, cfg, _ := e.current()
+	ch <- newChannelScrapeSuccessDesc(cfg.Channels)
+	ch <- newChannelLoginInfoDesc(cfg.Channels)
+	ch <- userCacheHitsDesc
+	ch <- userCacheMissesDesc
 }
 
 // collectorFlagAction generates a new action function for the given collector
@@ -88,98 +317,472 @@ func collectorFlagAction(collector string) func(ctx *kingpin.ParseContext) error
 	}
 }
 
-func NewExporter(logger *slog.Logger, client *helix.Client, eventsubClient *eventsub.Client, channelNames ChannelNames, filters ...string) (*Exporter, error) {
-	f := make(map[string]bool)
+func NewExporter(logger *slog.Logger, client HelixClient, eventsubClient *eventsub.Client, channelNames ChannelNames, filters ...string) (*Exporter, error) {
+	return NewExporterWithConfig(logger, client, eventsubClient, Config{Channels: channelNames.Channels()}, filters...)
+}
+
+// NewExporterWithConfig creates an exporter whose collectors are enabled by
+// cfg rather than by their flags only.
+func NewExporterWithConfig(logger *slog.Logger, client HelixClient, eventsubClient *eventsub.Client, cfg Config, filters ...string) (*Exporter, error) {
+	e, err := newExporter(logger, client, eventsubClient, cfg, filters...)
+	if err != nil {
+		return nil, err
+	}
+	users.configure(cfg.Channels.Names())
+
+	return e, nil
+}
+
+// newExporter creates an exporter without making its channels the ones the
+// user cache keeps, e.g. for probes.
+func newExporter(logger *slog.Logger, client HelixClient, eventsubClient *eventsub.Client, cfg Config, filters ...string) (*Exporter, error) {
+	e := &Exporter{
+		logger:         logger,
+		client:         client,
+		eventsubClient: eventsubClient,
+		filters:        make(map[string]bool),
+		snapshots:      make(map[string]snapshot),
+	}
+
 	for _, filter := range filters {
-		enabled, exist := collectorState[filter]
-		if !exist {
+		if _, exist := collectorState[filter]; !exist {
 			return nil, fmt.Errorf("missing collector: %s", filter)
 		}
 
-		if !*enabled {
+		if _, ok := cfg.channels(filter); !ok {
 			return nil, fmt.Errorf("disabled collector: %s", filter)
 		}
-		f[filter] = true
+		e.filters[filter] = true
+	}
+
+	collectors, err := e.newCollectors(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	for k := range collectors {
+		logger.Info("enabled collector", "collector", k)
+	}
+
+	e.config = cfg
+	e.collectors = collectors
+
+	return e, nil
+}
+
+// newCollectors creates the collectors enabled by cfg. Collectors are bound to
+// the channels they were created for, so every exporter and configuration
+// gets its own instances rather than sharing them.
+func (e *Exporter) newCollectors(cfg Config) (map[string]Collector, error) {
+	for name := range cfg.Collectors {
+		if _, exist := collectorState[name]; !exist {
+			return nil, fmt.Errorf("missing collector: %s", name)
+		}
+	}
+	if err := cfg.Channels.Validate(); err != nil {
+		return nil, err
 	}
 
 	collectors := make(map[string]Collector)
-	initiatedCollectorsMtx.Lock()
-	defer initiatedCollectorsMtx.Unlock()
-	for key, enabled := range collectorState {
-		if !*enabled || (len(f) > 0 && !f[key]) {
+	for key := range collectorState {
+		channels, ok := cfg.channels(key)
+		if !ok || (len(e.filters) > 0 && !e.filters[key]) {
 			continue
 		}
-		if collector, ok := initiatedCollectors[key]; ok {
-			collectors[key] = collector
-		} else {
-			collector, err := factories[key](logger, client, eventsubClient, channelNames)
-			if err != nil {
-				return nil, err
+		collector, err := factories[key](e.logger, e.client, e.eventsubClient, channels)
+		if err != nil {
+			return nil, err
+		}
+		collectors[key] = collector
+	}
+
+	return collectors, nil
+}
+
+// ApplyConfig replaces the channels and collectors of the running exporter.
+// The previous configuration is kept if any collector cannot be created.
+func (e *Exporter) ApplyConfig(cfg Config) error {
+	collectors, err := e.newCollectors(cfg)
+	if err != nil {
+		return err
+	}
+
+	e.mtx.Lock()
+	e.snapshotsMtx.Lock()
+
+	// results of the previous collectors are still valid for the same
+	// channels, so they are kept along with their polling schedule, but must
+	// not be served for channels which were removed
+	sameLabels := slices.Equal(e.config.Channels.staticLabelNames(), cfg.Channels.staticLabelNames())
+	for name := range e.snapshots {
+		if _, ok := collectors[name]; !ok || !sameLabels || !e.config.unchanged(cfg, name) {
+			delete(e.snapshots, name)
+		}
+	}
+	e.config = cfg
+	e.collectors = collectors
+	e.generation++
+	polling, pollInterval := e.stopPolling != nil, e.pollInterval
+
+	e.snapshotsMtx.Unlock()
+	e.mtx.Unlock()
+
+	users.configure(cfg.Channels.Names())
+	if polling {
+		e.StartPolling(pollInterval)
+	}
+
+	e.logger.Info("applied configuration", "channels", len(cfg.Channels), "collectors", len(collectors))
+	return nil
+}
+
+// Config returns the configuration the exporter is currently running with.
+func (e *Exporter) Config() Config {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	return e.config
+}
+
+// ForChannels creates an exporter sharing the client, configuration and rate
+// limiter of e, for the given channels and collectors only. Channels keep the
+// labels and collectors they are configured with in e. Event driven
+// collectors are left out, as they subscribe to the events of their channels.
+//
+// The exporter has no result of its own yet, so its collectors query the
+// Twitch API on every scrape regardless of their interval.
+func (e *Exporter) ForChannels(logger *slog.Logger, channelNames ChannelNames, filters ...string) (*Exporter, error) {
+	cfg := e.Config()
+	channels := channelNames.Channels()
+	for i, channel := range channels {
+		if configured, ok := cfg.Channels.lookup(channel.Name); ok {
+			configured.Name = channel.Name
+			channels[i] = configured
+		}
+	}
+	cfg.Channels = channels
+
+	for _, filter := range filters {
+		if eventDrivenCollectors[filter] {
+			return nil, fmt.Errorf("event driven collector: %s", filter)
+		}
+	}
+	if len(filters) == 0 {
+		for _, name := range slices.Sorted(maps.Keys(collectorState)) {
+			if _, ok := cfg.channels(name); ok && !eventDrivenCollectors[name] {
+				filters = append(filters, name)
 			}
-			collectors[key] = collector
-			initiatedCollectors[key] = collector
+		}
+		if len(filters) == 0 {
+			return nil, errors.New("no collector enabled")
 		}
 	}
 
-	for k := range collectors {
-		logger.Info("enabled collector", "collector", k)
+	exporter, err := newExporter(logger, e.client, nil, cfg, filters...)
+	if err != nil {
+		return nil, err
 	}
+	exporter.SetRateLimiter(e.rateLimiter)
+
+	return exporter, nil
+}
 
-	return &Exporter{
-		Collectors: collectors,
-		logger:     logger,
-	}, nil
+// current returns the collectors of the exporter along with the
+// configuration and generation they were created from.
+func (e *Exporter) current() (map[string]Collector, Config, uint64) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	return e.collectors, e.config, e.generation
 }
 
+// Collect implements prometheus.Collector, collectors are updated without
+// any deadline other than the collector timeout.
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.collect(context.Background(), ch)
+}
+
+// WithContext returns a prometheus.Collector for the exporter whose collector
+// updates are bound to ctx, typically derived from the scrape timeout.
+func (e *Exporter) WithContext(ctx context.Context) prometheus.Collector {
+	return exporterWithContext{Exporter: e, ctx: ctx}
+}
+
+type exporterWithContext struct {
+	*Exporter
+	ctx context.Context
+}
+
+func (e exporterWithContext) Collect(ch chan<- prometheus.Metric) {
+	e.collect(e.ctx, ch)
+}
+
+func (e *Exporter) collect(ctx context.Context, ch chan<- prometheus.Metric) {
+	ctx = withScrape(ctx)
+
+	collectors, cfg, generation := e.current()
+
+	e.snapshotsMtx.RLock()
+	polling := e.stopPolling != nil
+	e.snapshotsMtx.RUnlock()
+
+	var (
+		usersMtx sync.Mutex
+		resolved []helix.User
+	)
+
 	wg := sync.WaitGroup{}
-	wg.Add(len(e.Collectors))
-	for name, c := range e.Collectors {
+	wg.Add(len(collectors))
+	for name, c := range collectors {
 		go func(name string, c Collector) {
-			execute(name, c, ch, e.logger)
-			wg.Done()
+			defer wg.Done()
+
+			var s snapshot
+			if !polling {
+				s = e.refresh(ctx, name, c, cfg, generation)
+			} else {
+				// collectors which did not complete their first poll yet
+				// have nothing to expose
+				var ok bool
+				if s, ok = e.snapshot(name); !ok {
+					return
+				}
+			}
+			s.send(ch)
+
+			usersMtx.Lock()
+			resolved = append(resolved, s.users...)
+			usersMtx.Unlock()
 		}(name, c)
 	}
 	wg.Wait()
+
+	// channels resolve to the same users in every collector, so their login
+	// info is only exposed once
+	for _, m := range loginInfoMetrics(cfg.Channels, resolved) {
+		ch <- m
+	}
+	users.collect(ch)
+}
+
+// SetRateLimiter makes the exporter pause low priority collectors while the
+// rate limit budget reported by r is nearly exhausted.
+func (e *Exporter) SetRateLimiter(r RateLimiter) {
+	e.rateLimiter = r
+}
+
+// rateLimited returns whether the collector has to be paused to preserve the
+// rate limit budget.
+func (e *Exporter) rateLimited(name string) bool {
+	if e.rateLimiter == nil || collectorPriorities[name] != lowPriority {
+		return false
+	}
+
+	remaining, reset, ok := e.rateLimiter.RateLimitRemaining()
+	return ok && remaining < *rateLimitReserve && time.Now().Before(reset)
+}
+
+// refresh returns the last result of the collector if it is more recent than
+// the collector interval, and updates the collector otherwise. Failed results
+// are kept as well, with their failure reason, so that a failing collector
+// does not request the API on every scrape.
+// Low priority collectors keep serving their last result, however old, while
+// the rate limit budget is nearly exhausted.
+func (e *Exporter) refresh(ctx context.Context, name string, c Collector, cfg Config, generation uint64) snapshot {
+	s, ok := e.snapshot(name)
+	if ok && time.Since(s.timestamp) < cfg.interval(name) {
+		return s
+	}
+
+	if e.rateLimited(name) {
+		e.logger.Warn("rate limit budget nearly exhausted, skipping low priority collector", "name", name)
+		if ok {
+			return s
+		}
+		return snapshot{name: name, reason: failureReasonRateLimited, timestamp: time.Now()}
+	}
+
+	s = execute(ctx, name, c, cfg.Channels, e.logger)
+	e.storeSnapshot(s, generation)
+	return s
 }
 
-func execute(name string, c Collector, ch chan<- prometheus.Metric, logger *slog.Logger) {
+func (e *Exporter) snapshot(name string) (snapshot, bool) {
+	e.snapshotsMtx.RLock()
+	defer e.snapshotsMtx.RUnlock()
+
+	s, ok := e.snapshots[name]
+	return s, ok
+}
+
+// storeSnapshot stores the result of a collector, unless the collector was
+// replaced by ApplyConfig since.
+func (e *Exporter) storeSnapshot(s snapshot, generation uint64) {
+	e.snapshotsMtx.Lock()
+	defer e.snapshotsMtx.Unlock()
+
+	if generation == e.generation {
+		e.snapshots[s.name] = s
+	}
+}
+
+// execute runs a single update of the collector and returns its result. The
+// update is abandoned once ctx or the collector timeout expires, keeping the
+// metrics received until then.
+func execute(ctx context.Context, name string, c Collector, channels Channels, logger *slog.Logger) snapshot {
+	if *collectorTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *collectorTimeout)
+		defer cancel()
+	}
+
+	ctx, results := withChannelResults(ctx, channels)
+
+	metrics := make(chan prometheus.Metric)
+	updated := make(chan error, 1)
+
 	begin := time.Now()
-	err := c.Update(ch)
+	go func() {
+		updated <- c.Update(ctx, metrics)
+		close(metrics)
+	}()
+
+	var (
+		m   []prometheus.Metric
+		err error
+	)
+receive:
+	for {
+		select {
+		case metric, ok := <-metrics:
+			if !ok {
+				err = <-updated
+				break receive
+			}
+			m = append(m, metric)
+		case <-ctx.Done():
+			err = ctx.Err()
+			// the update keeps running in the background until its current
+			// request completes, so its remaining metrics are discarded
+			go func() {
+				for range metrics {
+				}
+			}()
+			break receive
+		}
+	}
 	duration := time.Since(begin)
+	m = append(m, results.metrics(name)...)
+
 	var success float64
+	var reason string
 
-	if err != nil {
-		if IsNoDataError(err) {
-			logger.Error("collector returned no data", "name", name, "duration_seconds", duration.Seconds(), "err", err)
-		} else {
-			logger.Error("collector failed", "name", name, "duration_seconds", duration.Seconds(), "err", err)
-		}
-		success = 0
-	} else {
+	switch {
+	case err == nil:
 		logger.Info("collector succeeded", "name", name, "duration_seconds", duration.Seconds())
 		success = 1
+	case IsNoDataError(err):
+		logger.Error("collector returned no data", "name", name, "duration_seconds", duration.Seconds(), "err", err)
+		reason = failureReasonNoData
+	case errors.Is(err, context.DeadlineExceeded):
+		logger.Error("collector timed out", "name", name, "duration_seconds", duration.Seconds(), "err", err)
+		reason = failureReasonTimeout
+	default:
+		logger.Error("collector failed", "name", name, "duration_seconds", duration.Seconds(), "err", err)
+		reason = failureReasonError
 	}
 
-	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), name)
-	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, name)
+	return snapshot{
+		name:      name,
+		metrics:   m,
+		duration:  duration,
+		success:   success,
+		reason:    reason,
+		timestamp: begin.Add(duration),
+		users:     results.resolvedUsers(),
+	}
 }
 
 // Collector is the interface a collector has to implement.
 type Collector interface {
-	// Get new metrics and expose them via prometheus registry.
-	Update(ch chan<- prometheus.Metric) error
+	// Get new metrics and expose them via prometheus registry. Collectors
+	// should stop requesting the Twitch API once ctx is done.
+	Update(ctx context.Context, ch chan<- prometheus.Metric) error
 }
 
 type typedDesc struct {
 	desc      *prometheus.Desc
 	valueType prometheus.ValueType
+	// channels are the channels whose labels are added to the channel
+	// metrics, the desc is created with channels.labelNames.
+	channels Channels
 }
 
 func (d *typedDesc) mustNewConstMetric(value float64, labels ...string) prometheus.Metric {
 	return prometheus.MustNewConstMetric(d.desc, d.valueType, value, labels...)
 }
 
+// mustNewChannelMetric returns a metric of the channel of user, labelled with
+// the labels identifying the channel, labels and the configured labels of the
+// channel.
+func (d *typedDesc) mustNewChannelMetric(value float64, user helix.User, labels ...string) prometheus.Metric {
+	return d.newChannelMetric(value, usernameLabel(user), user, labels...)
+}
+
+// mustNewLoginMetric is mustNewChannelMetric for the metrics which were
+// already labelled with the login of the channel, and keep it with
+// --collector.legacy-username-label.
+func (d *typedDesc) mustNewLoginMetric(value float64, user helix.User, labels ...string) prometheus.Metric {
+	return d.newChannelMetric(value, loginLabel(user), user, labels...)
+}
+
+func (d *typedDesc) newChannelMetric(value float64, username string, user helix.User, labels ...string) prometheus.Metric {
+	values := append(channelLabels(username, user), labels...)
+	return d.mustNewConstMetric(value, append(values, d.channels.labelValues(user)...)...)
+}
+
+// channelLabelNames are the names of the labels identifying the channel of
+// every channel metric, followed by the names of the labels of the metric.
+// With --collector.legacy-username-label, the channel is only identified by
+// its username, as before the user_id label.
+func channelLabelNames(labels ...string) []string {
+	if *legacyUsernameLabel {
+		return append([]string{"username"}, labels...)
+	}
+	return append([]string{"username", "user_id"}, labels...)
+}
+
+// channelLabels returns the values of the labels identifying the channel of
+// user, which are the same in every collector so that channel metrics can be
+// joined. The display name is only exposed by twitch_channel_login_info.
+func channelLabels(username string, user helix.User) []string {
+	if *legacyUsernameLabel {
+		return []string{username}
+	}
+	return []string{username, user.ID}
+}
+
+// usernameLabel returns the username label of the channel of user, its
+// lowercase login unless --collector.legacy-username-label is set.
+func usernameLabel(user helix.User) string {
+	if *legacyUsernameLabel {
+		return user.DisplayName
+	}
+	return loginLabel(user)
+}
+
+// LegacyUsernameLabel returns whether --collector.legacy-username-label is
+// set, so that other metrics joined with the channel metrics on username
+// follow it.
+func LegacyUsernameLabel() bool {
+	return *legacyUsernameLabel
+}
+
+// loginLabel returns the lowercase login of the channel of user.
+func loginLabel(user helix.User) string {
+	return strings.ToLower(user.Login)
+}
+
 var ErrNoData = errors.New("collector returned no data")
 
 func IsNoDataError(err error) bool {
@@ -189,11 +792,16 @@ func IsNoDataError(err error) bool {
 // countPaginated counts items across paginated API responses.
 // fetchPage is called with a cursor (empty string for the first page) and
 // returns the number of items on that page, the next cursor, and any error.
-func countPaginated(fetchPage func(cursor string) (count int, next string, err error)) (int, error) {
+// No further page is requested once ctx is done.
+func countPaginated(ctx context.Context, fetchPage func(cursor string) (count int, next string, err error)) (int, error) {
 	var total int
 	cursor := ""
 
 	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
 		count, next, err := fetchPage(cursor)
 		if err != nil {
 			return 0, err
@@ -209,21 +817,3 @@ func countPaginated(fetchPage func(cursor string) (count int, next string, err e
 
 	return total, nil
 }
-
-// todo: we can avoid this with a shared cache of username to userID that has a short TTL
-// getUsers resolves channel login names to Twitch user objects.
-// It returns an error if the API call fails or returns a non-200 status.
-func getUsers(client *helix.Client, logger *slog.Logger, logins []string) ([]helix.User, error) {
-	resp, err := client.GetUsers(&helix.UsersParams{
-		Logins: logins,
-	})
-	if err != nil {
-		logger.Error("Failed to collect users stats from Twitch helix API", "err", err)
-		return nil, err
-	}
-	if resp.StatusCode != 200 {
-		logger.Error("Failed to collect users stats from Twitch helix API", "err", resp.ErrorMessage)
-		return nil, errors.New(resp.ErrorMessage)
-	}
-	return resp.Data.Users, nil
-}
@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/damoun/twitch_exporter/internal/helixtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promslog"
+)
+
+func TestMain(m *testing.M) {
+	// flags hold their defaults only once parsed
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// testCollector exposes a Collector as an unchecked prometheus.Collector,
+// failing the test if its update fails.
+type testCollector struct {
+	Collector
+	t *testing.T
+}
+
+func (c testCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c testCollector) Collect(ch chan<- prometheus.Metric) {
+	if err := c.Update(context.Background(), ch); err != nil {
+		c.t.Errorf("update failed: %v", err)
+	}
+}
+
+// newTestCollector returns a fake helix server and the collector registered
+// as name for the dam0un channel, sending its requests to the server.
+func newTestCollector(t *testing.T, name string) (*helixtest.Server, testCollector) {
+	t.Helper()
+
+	s, client := newTestClient(t)
+	c, err := factories[name](promslog.NewNopLogger(), client, nil, ChannelNames{"dam0un"}.Channels())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, testCollector{c, t}
+}
+
+// expectMetrics compares the metrics of a single update of c with expected,
+// in the text exposition format.
+func expectMetrics(t *testing.T, c testCollector, expected string, metricNames ...string) {
+	t.Helper()
+
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), metricNames...); err != nil {
+		t.Error(err)
+	}
+}
+
+// expectUpdateError checks that a single update of c fails.
+func expectUpdateError(t *testing.T, c testCollector) {
+	t.Helper()
+
+	ch := make(chan prometheus.Metric, 100)
+	if err := c.Update(context.Background(), ch); err == nil {
+		t.Error("expected the update to fail")
+	}
+}
+
+func TestLegacyUsernameLabel(t *testing.T) {
+	*legacyUsernameLabel = true
+	t.Cleanup(func() { *legacyUsernameLabel = false })
+
+	_, clips := newTestCollector(t, "channel_clips_total")
+	expectMetrics(t, clips, `
+# HELP twitch_channel_clips_total The number of clips of a channel.
+# TYPE twitch_channel_clips_total gauge
+twitch_channel_clips_total{username="Dam0un"} 2
+`)
+
+	// channel_up was already labelled with the login
+	_, up := newTestCollector(t, "channel_up")
+	expectMetrics(t, up, `
+# HELP twitch_channel_up Is the channel live.
+# TYPE twitch_channel_up gauge
+twitch_channel_up{game="Just Chatting",username="dam0un"} 1
+`)
+
+	_, bits := newTestCollector(t, "channel_bits_leaderboard")
+	expectMetrics(t, bits, `
+# HELP twitch_channel_bits_leaderboard The bits leaderboard score for users on a channel.
+# TYPE twitch_channel_bits_leaderboard gauge
+twitch_channel_bits_leaderboard{rank="1",user_id="2",user_name="surdaft",username="Dam0un"} 500
+twitch_channel_bits_leaderboard{rank="2",user_id="3",user_name="spammer",username="Dam0un"} 100
+`)
+}
@@ -0,0 +1,281 @@
+package collector
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promslog"
+)
+
+func TestExporterCachesFailedUpdates(t *testing.T) {
+	s, client := newTestClient(t)
+	s.Error("/clips", 500, "Internal Server Error")
+
+	e, err := NewExporter(promslog.NewNopLogger(), client, nil, ChannelNames{"dam0un"}, "channel_clips_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e)
+
+	expected := `
+# HELP twitch_scrape_collector_success node_exporter: Whether a collector succeeded.
+# TYPE twitch_scrape_collector_success gauge
+twitch_scrape_collector_success{collector="channel_clips_total"} 0
+# HELP twitch_scrape_collector_failure Reason of the failure of a collector, only exposed when it failed.
+# TYPE twitch_scrape_collector_failure gauge
+twitch_scrape_collector_failure{collector="channel_clips_total",reason="error"} 1
+`
+	for range 2 {
+		if err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+			"twitch_scrape_collector_success", "twitch_scrape_collector_failure"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := s.Requests("/clips"); n != 1 {
+		t.Errorf("expected the failed update to be cached, got %d clips requests", n)
+	}
+}
+
+func TestForChannelsLeavesOutEventDrivenCollectors(t *testing.T) {
+	_, client := newTestClient(t)
+	logger := promslog.NewNopLogger()
+
+	enabled := true
+	cfg := Config{
+		Channels:   ChannelNames{"dam0un"}.Channels(),
+		Collectors: map[string]CollectorConfig{"channel_chat_messages_total": {Enabled: &enabled}},
+	}
+	e, err := NewExporterWithConfig(logger, client, nil, cfg, "channel_up")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	probe, err := e.ForChannels(logger, ChannelNames{"dam0un"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := probe.collectors["channel_chat_messages_total"]; ok {
+		t.Error("event driven collector created for a probe")
+	}
+	if _, ok := probe.collectors["channel_up"]; !ok {
+		t.Error("channel_up not created for a probe")
+	}
+
+	if _, err := e.ForChannels(logger, ChannelNames{"dam0un"}, "channel_chat_messages_total"); err == nil {
+		t.Error("expected probing an event driven collector to fail")
+	}
+}
+
+func TestPollingSharesStreams(t *testing.T) {
+	s, client := newTestClient(t)
+
+	e, err := NewExporter(promslog.NewNopLogger(), client, nil, ChannelNames{"dam0un"}, "channel_up", "channel_viewers_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.StartPolling(time.Hour)
+	defer e.StopPolling()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, up := e.snapshot("channel_up")
+		_, viewers := e.snapshot("channel_viewers_total")
+		if up && viewers {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("collectors not polled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := s.Requests("/streams"); n != 1 {
+		t.Errorf("expected the polling round to share the streams, got %d streams requests", n)
+	}
+}
+
+func TestSharedStreamsOutliveFirstCollector(t *testing.T) {
+	s, client := newTestClient(t)
+	logger := promslog.NewNopLogger()
+
+	ctx := withScrape(context.Background())
+	first, cancel := context.WithCancel(ctx)
+	cancel()
+
+	// the collector requesting the streams first being done does not fail
+	// the other collectors sharing them
+	_, _ = getStreams(first, client, logger, []string{"dam0un"})
+	streams, err := getStreams(ctx, client, logger, []string{"dam0un"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := streams["dam0un"]; !ok {
+		t.Error("expected dam0un to be live")
+	}
+	if n := s.Requests("/streams"); n != 1 {
+		t.Errorf("expected 1 streams request, got %d", n)
+	}
+}
+
+func TestApplyConfigKeepsUnchangedCollectors(t *testing.T) {
+	s, client := newTestClient(t)
+
+	cfg := Config{Channels: Channels{{Name: "dam0un"}}}
+	e, err := NewExporterWithConfig(promslog.NewNopLogger(), client, nil, cfg, "channel_clips_total", "channel_emotes_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.StartPolling(time.Hour)
+	defer e.StopPolling()
+
+	waitFor := func(what string, done func() bool) {
+		t.Helper()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for !done() {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s not polled", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("collectors", func() bool {
+		_, clips := e.snapshot("channel_clips_total")
+		_, emotes := e.snapshot("channel_emotes_total")
+		return clips && emotes
+	})
+	clips, _ := e.snapshot("channel_clips_total")
+
+	cfg.Channels = append(cfg.Channels, Channel{Name: "surdaft", ExcludeCollectors: []string{"channel_clips_total"}})
+	if err := e.ApplyConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("channel_emotes_total", func() bool {
+		return s.Requests("/chat/emotes") >= 2
+	})
+
+	if kept, ok := e.snapshot("channel_clips_total"); !ok || !kept.timestamp.Equal(clips.timestamp) {
+		t.Error("expected the result of channel_clips_total to be kept")
+	}
+	if n := s.Requests("/clips"); n != 1 {
+		t.Errorf("expected channel_clips_total to keep its schedule, got %d clips requests", n)
+	}
+}
+
+func TestChannelResultsHaveChannelLabels(t *testing.T) {
+	_, client := newTestClient(t)
+
+	cfg := Config{Channels: Channels{
+		{Name: "dam0un", Labels: map[string]string{"team": "exporters"}},
+		{Name: "gone"},
+	}}
+	e, err := NewExporterWithConfig(promslog.NewNopLogger(), client, nil, cfg, "channel_clips_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e)
+
+	expected := `
+# HELP twitch_channel_login_info Current login and display name of a channel, the value is always 1.
+# TYPE twitch_channel_login_info gauge
+twitch_channel_login_info{display_name="Dam0un",login="dam0un",team="exporters",user_id="1"} 1
+# HELP twitch_channel_scrape_success Whether a collector succeeded for a channel, error_class tells why it did not.
+# TYPE twitch_channel_scrape_success gauge
+twitch_channel_scrape_success{collector="channel_clips_total",error_class="",team="exporters",user_id="1",username="dam0un"} 1
+twitch_channel_scrape_success{collector="channel_clips_total",error_class="not_found",team="",user_id="",username="gone"} 0
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"twitch_channel_login_info", "twitch_channel_scrape_success"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReservedChannelLabelsArePrefixed(t *testing.T) {
+	reserved := reservedLabelNames()
+	for _, name := range []string{"username", "user_id", "login", "collector", "error_class", "tier", "game"} {
+		if !reserved[name] {
+			t.Errorf("expected %q to be reserved", name)
+		}
+	}
+
+	enabled := true
+	collectors := make(map[string]CollectorConfig)
+	for name := range factories {
+		// requires an eventsub client
+		if name != "channel_chat_messages_total" {
+			collectors[name] = CollectorConfig{Enabled: &enabled}
+		}
+	}
+
+	for name := range reserved {
+		t.Run(name, func(t *testing.T) {
+			_, client := newTestClient(t)
+
+			cfg := Config{
+				Channels:   Channels{{Name: "dam0un", Labels: map[string]string{name: "value"}}},
+				Collectors: collectors,
+			}
+			e, err := NewExporterWithConfig(promslog.NewNopLogger(), client, nil, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(e)
+
+			families, err := registry.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, family := range families {
+				if family.GetName() != "twitch_channel_scrape_success" {
+					continue
+				}
+				for _, label := range family.GetMetric()[0].GetLabel() {
+					if label.GetName() == reservedLabelPrefix+name && label.GetValue() == "value" {
+						return
+					}
+				}
+			}
+			t.Errorf("expected the %q label as %s%s", name, reservedLabelPrefix, name)
+		})
+	}
+}
+
+func TestPrefixedChannelLabelMustNotClash(t *testing.T) {
+	channels := Channels{{Name: "dam0un", Labels: map[string]string{"tier": "1", "channel_tier": "2"}}}
+	if err := channels.Validate(); err == nil {
+		t.Error("expected tier and channel_tier to clash")
+	}
+}
+
+type fixedRateLimiter struct {
+	remaining int
+	reset     time.Time
+	ok        bool
+}
+
+func (l fixedRateLimiter) RateLimitRemaining() (int, time.Time, bool) {
+	return l.remaining, l.reset, l.ok
+}
+
+func TestRateLimitersReportLowestBudget(t *testing.T) {
+	soon := time.Now().Add(time.Minute)
+	limiters := RateLimiters{
+		fixedRateLimiter{remaining: 700, reset: soon, ok: true},
+		fixedRateLimiter{remaining: 10, reset: soon, ok: true},
+		// refilled already
+		fixedRateLimiter{remaining: 0, reset: time.Now().Add(-time.Minute), ok: true},
+		fixedRateLimiter{},
+	}
+
+	remaining, reset, ok := limiters.RateLimitRemaining()
+	if !ok || remaining != 10 || !reset.Equal(soon) {
+		t.Errorf("expected 10 points remaining until %v, got %d until %v (ok: %v)", soon, remaining, reset, ok)
+	}
+}
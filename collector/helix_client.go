@@ -0,0 +1,34 @@
+package collector
+
+import "github.com/nicklaw5/helix/v2"
+
+// HelixClient is the subset of the helix client used by the collectors. It is
+// implemented by *helix.Client.
+type HelixClient interface {
+	// users
+	GetUsers(params *helix.UsersParams) (*helix.UsersResponse, error)
+
+	// streams and channels
+	GetStreams(params *helix.StreamsParams) (*helix.StreamsResponse, error)
+	GetChannelInformation(params *helix.GetChannelInformationParams) (*helix.GetChannelInformationResponse, error)
+	GetChannelFollows(params *helix.GetChannelFollowsParams) (*helix.GetChannelFollowersResponse, error)
+	GetChannelEmotes(params *helix.GetChannelEmotesParams) (*helix.GetChannelEmotesResponse, error)
+	GetClips(params *helix.ClipsParams) (*helix.ClipsResponse, error)
+
+	// chat
+	GetChatSettings(params *helix.GetChatSettingsParams) (*helix.GetChatSettingsResponse, error)
+	GetChannelChatChatters(params *helix.GetChatChattersParams) (*helix.GetChatChattersResponse, error)
+
+	// moderation
+	GetModerators(params *helix.GetModeratorsParams) (*helix.ModeratorsResponse, error)
+	GetChannelVips(params *helix.GetChannelVipsParams) (*helix.ChannelVipsResponse, error)
+	GetBannedUsers(params *helix.BannedUsersParams) (*helix.BannedUsersResponse, error)
+
+	// monetization
+	GetSubscriptions(params *helix.SubscriptionsParams) (*helix.SubscriptionsResponse, error)
+	GetBitsLeaderboard(params *helix.BitsLeaderboardParams) (*helix.BitsLeaderboardResponse, error)
+	GetCreatorGoals(params *helix.GetCreatorGoalsParams) (*helix.CreatorGoalsResponse, error)
+	GetCharityCampaigns(params *helix.CharityCampaignsParams) (*helix.CharityCampaignsResponse, error)
+}
+
+var _ HelixClient = (*helix.Client)(nil)
@@ -0,0 +1,153 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nicklaw5/helix/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// snapshot is the result of a single update of a collector.
+type snapshot struct {
+	name      string
+	metrics   []prometheus.Metric
+	duration  time.Duration
+	success   float64
+	reason    string
+	timestamp time.Time
+	// users are the users the channels of the collector resolved to.
+	users []helix.User
+}
+
+// send exposes the metrics of the snapshot along with the scrape metrics of
+// the collector that produced it.
+func (s snapshot) send(ch chan<- prometheus.Metric) {
+	for _, m := range s.metrics {
+		ch <- m
+	}
+
+	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, s.duration.Seconds(), s.name)
+	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, s.success, s.name)
+	if s.reason != "" {
+		ch <- prometheus.MustNewConstMetric(scrapeFailureDesc, prometheus.GaugeValue, 1, s.name, s.reason)
+	}
+	ch <- prometheus.MustNewConstMetric(scrapeCacheAgeDesc, prometheus.GaugeValue, time.Since(s.timestamp).Seconds(), s.name)
+	ch <- prometheus.MustNewConstMetric(scrapeLastUpdateDesc, prometheus.GaugeValue, float64(s.timestamp.UnixNano())/1e9, s.name)
+}
+
+// StartPolling updates every collector in the background once per interval,
+// or once per collector interval if it is longer. Until StopPolling is called,
+// scrapes are served from the last result of each collector instead of calling
+// the Twitch API. Polling restarts with the new collectors whenever the
+// configuration is replaced by ApplyConfig.
+//
+// Collectors polled at the same interval are updated together, sharing the
+// requests of a scrape, e.g. the live streams. Collectors whose last result
+// was kept by ApplyConfig are next updated once it is due, rather than right
+// away.
+func (e *Exporter) StartPolling(interval time.Duration) {
+	e.StopPolling()
+
+	collectors, cfg, generation := e.current()
+
+	e.snapshotsMtx.Lock()
+	defer e.snapshotsMtx.Unlock()
+
+	rounds := make(map[time.Duration]map[string]Collector)
+	due := make(map[time.Duration]map[string]time.Time)
+	for name, c := range collectors {
+		every := max(interval, cfg.interval(name))
+		if rounds[every] == nil {
+			rounds[every] = make(map[string]Collector)
+			due[every] = make(map[string]time.Time)
+		}
+		rounds[every][name] = c
+		if s, ok := e.snapshots[name]; ok {
+			due[every][name] = s.timestamp.Add(every)
+		}
+	}
+
+	stop := make(chan struct{})
+	for every, collectors := range rounds {
+		go e.poll(collectors, due[every], cfg.Channels, every, generation, stop)
+	}
+
+	e.stopPolling = stop
+	e.pollInterval = interval
+}
+
+// StopPolling stops the background updates started by StartPolling, after
+// which collectors are updated on scrapes again.
+func (e *Exporter) StopPolling() {
+	e.snapshotsMtx.Lock()
+	defer e.snapshotsMtx.Unlock()
+
+	if e.stopPolling != nil {
+		close(e.stopPolling)
+	}
+	e.stopPolling = nil
+}
+
+// poll updates the collectors once per interval, each one first at its due
+// time, or right away if it has none.
+func (e *Exporter) poll(collectors map[string]Collector, due map[string]time.Time, channels Channels, interval time.Duration, generation uint64, stop <-chan struct{}) {
+	for {
+		now := time.Now()
+		round := make(map[string]Collector)
+		next := now.Add(interval)
+		for name, c := range collectors {
+			if !due[name].After(now) {
+				round[name] = c
+				due[name] = now.Add(interval)
+			}
+			if due[name].Before(next) {
+				next = due[name]
+			}
+		}
+		e.pollRound(round, channels, generation, stop)
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// pollRound updates the collectors concurrently within a single scrape, whose
+// shared requests are bound by the collector timeout.
+func (e *Exporter) pollRound(collectors map[string]Collector, channels Channels, generation uint64, stop <-chan struct{}) {
+	ctx := context.Background()
+	if *collectorTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *collectorTimeout)
+		defer cancel()
+	}
+	ctx = withScrape(ctx)
+
+	wg := sync.WaitGroup{}
+	for name, c := range collectors {
+		if e.rateLimited(name) {
+			e.logger.Warn("rate limit budget nearly exhausted, pausing low priority collector", "name", name)
+			continue
+		}
+
+		wg.Add(1)
+		go func(name string, c Collector) {
+			defer wg.Done()
+
+			s := execute(ctx, name, c, channels, e.logger)
+
+			select {
+			case <-stop:
+			default:
+				e.storeSnapshot(s, generation)
+			}
+		}(name, c)
+	}
+	wg.Wait()
+}
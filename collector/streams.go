@@ -0,0 +1,117 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/nicklaw5/helix/v2"
+)
+
+// maxStreamsPerRequest is the maximum number of logins accepted, and of
+// streams returned, by a single call to the helix streams endpoint.
+const maxStreamsPerRequest = 100
+
+// liveStreams holds the streams of the live channels, by lowercase login.
+type liveStreams map[string]helix.Stream
+
+type scrapeContextKey struct{}
+
+// scrape holds the API results shared by every collector during a single
+// scrape, so that collectors relying on the same data only request it once.
+type scrape struct {
+	// ctx bounds the shared requests, rather than the context of the
+	// collector requesting them first, which may be done before the others.
+	ctx context.Context
+
+	mtx     sync.Mutex
+	streams map[streamsKey]*streamsResult
+}
+
+type streamsKey struct {
+	client HelixClient
+	logins string
+}
+
+type streamsResult struct {
+	once    sync.Once
+	streams liveStreams
+	err     error
+}
+
+// withScrape returns a context carrying a new scrape.
+func withScrape(ctx context.Context) context.Context {
+	return context.WithValue(ctx, scrapeContextKey{}, &scrape{
+		ctx:     ctx,
+		streams: make(map[streamsKey]*streamsResult),
+	})
+}
+
+// getStreams returns the live streams among the given logins. Within a scrape,
+// the streams are only requested once for every set of logins, bound to the
+// context of the scrape.
+func getStreams(ctx context.Context, client HelixClient, logger *slog.Logger, logins []string) (liveStreams, error) {
+	s, ok := ctx.Value(scrapeContextKey{}).(*scrape)
+	if !ok {
+		return requestStreams(ctx, client, logger, logins)
+	}
+
+	key := streamsKey{client: client, logins: strings.Join(logins, ",")}
+	s.mtx.Lock()
+	result, ok := s.streams[key]
+	if !ok {
+		result = &streamsResult{}
+		s.streams[key] = result
+	}
+	s.mtx.Unlock()
+
+	result.once.Do(func() {
+		result.streams, result.err = requestStreams(s.ctx, client, logger, logins)
+	})
+	return result.streams, result.err
+}
+
+// requestStreams requests the live streams among the given logins from the
+// API, in batches of logins and following the pagination of every batch.
+func requestStreams(ctx context.Context, client HelixClient, logger *slog.Logger, logins []string) (liveStreams, error) {
+	streams := make(liveStreams)
+
+	for len(logins) > 0 {
+		batch := logins[:min(len(logins), maxStreamsPerRequest)]
+		logins = logins[len(batch):]
+
+		cursor := ""
+		for {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			resp, err := client.GetStreams(&helix.StreamsParams{
+				UserLogins: batch,
+				First:      maxStreamsPerRequest,
+				After:      cursor,
+			})
+			if err != nil {
+				logger.Error("could not get streams", "err", err)
+				return nil, err
+			}
+			if resp.StatusCode != 200 {
+				logger.Error("could not get streams", "err", resp.ErrorMessage)
+				return nil, errors.New(resp.ErrorMessage)
+			}
+
+			for _, s := range resp.Data.Streams {
+				streams[strings.ToLower(s.UserLogin)] = s
+			}
+
+			cursor = resp.Data.Pagination.Cursor
+			if cursor == "" || len(resp.Data.Streams) == 0 {
+				break
+			}
+		}
+	}
+
+	return streams, nil
+}
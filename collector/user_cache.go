@@ -0,0 +1,557 @@
+package collector
+
+import (
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/nicklaw5/helix/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxUsersPerRequest is the maximum number of logins or IDs accepted by a
+// single call to the helix users endpoint.
+const maxUsersPerRequest = 100
+
+// userNotFoundTTL is how long logins and IDs which did not resolve to any user
+// are remembered, bounded by the user cache TTL.
+const userNotFoundTTL = time.Minute
+
+var (
+	userCacheTTL = kingpin.Flag("twitch.user-cache-ttl",
+		"How long resolved Twitch users are cached before being requested again.").
+		Default("5m").Duration()
+
+	userCacheHitsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "user_cache", "hits_total"),
+		"Number of user lookups served from the user cache.",
+		nil, nil,
+	)
+	userCacheMissesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "user_cache", "misses_total"),
+		"Number of user lookups that required a request to the Twitch helix API.",
+		nil, nil,
+	)
+
+	// users is the process wide cache shared by every collector.
+	users = newUserCache()
+)
+
+type cachedUser struct {
+	user    helix.User
+	expires time.Time
+}
+
+// userCall is a request to the API in flight, which concurrent lookups of the
+// same keys wait for rather than sending their own.
+type userCall struct {
+	done chan struct{}
+	err  error
+}
+
+// userCache caches Twitch users by login and by ID, so that collectors
+// resolving the same channels during a scrape only hit the API once.
+type userCache struct {
+	mtx     sync.Mutex
+	byLogin map[string]cachedUser
+	byID    map[string]cachedUser
+	// self holds the user owning the token of each client, which is what the
+	// API returns when no login or ID is given.
+	self map[HelixClient]cachedUser
+	// notFound holds the expiry of the logins and IDs which did not resolve,
+	// by cache key.
+	notFound map[string]time.Time
+	// inflight holds the requests in flight by cache key, and inflightSelf
+	// the token owner requests by client.
+	inflight     map[string]*userCall
+	inflightSelf map[HelixClient]*userCall
+
+	// configuredLogins and configuredIDs are the channels of the exporter,
+	// whose expired entries are kept as the history the renamed channels are
+	// detected with. The other expired entries are swept once per TTL.
+	configuredLogins map[string]bool
+	configuredIDs    map[string]bool
+	swept            time.Time
+
+	hits   float64
+	misses float64
+}
+
+func newUserCache() *userCache {
+	return &userCache{
+		byLogin: make(map[string]cachedUser),
+		byID:    make(map[string]cachedUser),
+		self:    make(map[HelixClient]cachedUser),
+
+		notFound:     make(map[string]time.Time),
+		inflight:     make(map[string]*userCall),
+		inflightSelf: make(map[HelixClient]*userCall),
+	}
+}
+
+// cacheKey returns the key of a login or an ID, shared by the not found and
+// in flight entries. Logins are case insensitive.
+func cacheKey(key string, byID bool) string {
+	if byID {
+		return "id:" + key
+	}
+	return "login:" + strings.ToLower(key)
+}
+
+// lookup returns the fresh cached users for the given keys, by login or by
+// ID, together with the keys which have to be requested from the API. Keys
+// known not to resolve are neither found nor missing.
+func (c *userCache) lookup(keys []string, byID bool, now time.Time) (map[string]helix.User, []string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	found := make(map[string]helix.User, len(keys))
+	var missing []string
+	for _, key := range keys {
+		user, ok, fresh := c.peek(key, byID, now)
+		if !fresh {
+			c.misses++
+			missing = append(missing, key)
+			continue
+		}
+		c.hits++
+		if ok {
+			found[c.foundKey(key, byID)] = user
+		}
+	}
+
+	return found, missing
+}
+
+// peek returns the cached user of key, ok is false when the key is known not
+// to resolve and fresh is false when the key has to be requested. The caller
+// must hold the lock.
+func (c *userCache) peek(key string, byID bool, now time.Time) (user helix.User, ok, fresh bool) {
+	entries := c.byLogin
+	if byID {
+		entries = c.byID
+	}
+
+	entry, ok := entries[c.foundKey(key, byID)]
+	if ok && now.Before(entry.expires) {
+		return entry.user, true, true
+	}
+	if expires, ok := c.notFound[cacheKey(key, byID)]; ok && now.Before(expires) {
+		return helix.User{}, false, true
+	}
+	return helix.User{}, false, false
+}
+
+// foundKey returns the key of the users found by lookup: the lowercase login
+// or the ID.
+func (c *userCache) foundKey(key string, byID bool) string {
+	if byID {
+		return key
+	}
+	return strings.ToLower(key)
+}
+
+// begin registers a call requesting the keys which are not in flight yet,
+// which it returns as owned, along with the calls in flight to wait for.
+func (c *userCache) begin(keys []string, byID bool) (call *userCall, owned []string, waits []*userCall) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	call = &userCall{done: make(chan struct{})}
+	seen := make(map[*userCall]bool)
+	for _, key := range keys {
+		k := cacheKey(key, byID)
+		if other, ok := c.inflight[k]; ok {
+			if !seen[other] {
+				seen[other] = true
+				waits = append(waits, other)
+			}
+			continue
+		}
+		c.inflight[k] = call
+		owned = append(owned, key)
+	}
+	return call, owned, waits
+}
+
+// finish completes the call of the owned keys, remembering the keys which did
+// not resolve unless the call failed.
+func (c *userCache) finish(call *userCall, owned []string, byID bool, err error, now time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for k, expires := range c.notFound {
+		if !now.Before(expires) {
+			delete(c.notFound, k)
+		}
+	}
+
+	expires := now.Add(min(userNotFoundTTL, *userCacheTTL))
+	for _, key := range owned {
+		k := cacheKey(key, byID)
+		delete(c.inflight, k)
+		if err != nil {
+			continue
+		}
+		if _, _, fresh := c.peek(key, byID, now); !fresh {
+			c.notFound[k] = expires
+		}
+	}
+	call.err = err
+	close(call.done)
+}
+
+// collected returns the users cached for keys once the calls they waited for
+// completed, keyed like lookup.
+func (c *userCache) collected(keys []string, byID bool, now time.Time) map[string]helix.User {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	found := make(map[string]helix.User, len(keys))
+	for _, key := range keys {
+		if user, ok, _ := c.peek(key, byID, now); ok {
+			found[c.foundKey(key, byID)] = user
+		}
+	}
+	return found
+}
+
+// lookupSelf returns the cached owner of the token used by client.
+func (c *userCache) lookupSelf(client HelixClient, now time.Time) (helix.User, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entry, ok := c.self[client]
+	if ok && now.Before(entry.expires) {
+		c.hits++
+		return entry.user, true
+	}
+	c.misses++
+	return helix.User{}, false
+}
+
+// configure sets the channels of the exporter, whose users are kept once
+// expired.
+func (c *userCache) configure(channelNames ChannelNames) {
+	logins, ids := channelNames.split()
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.configuredLogins = make(map[string]bool, len(logins))
+	for _, login := range logins {
+		c.configuredLogins[strings.ToLower(login)] = true
+	}
+	c.configuredIDs = make(map[string]bool, len(ids))
+	for _, id := range ids {
+		c.configuredIDs[id] = true
+	}
+}
+
+// sweep removes the expired users which are neither configured nor the user
+// of a configured login, so that the cache does not grow with every channel
+// ever discovered. The caller must hold the lock.
+func (c *userCache) sweep(now time.Time) {
+	keepIDs := maps.Clone(c.configuredIDs)
+	if keepIDs == nil {
+		keepIDs = make(map[string]bool)
+	}
+	for login, entry := range c.byLogin {
+		switch {
+		case c.configuredLogins[login]:
+			keepIDs[entry.user.ID] = true
+		case !now.Before(entry.expires):
+			delete(c.byLogin, login)
+		}
+	}
+	for id, entry := range c.byID {
+		if !keepIDs[id] && !now.Before(entry.expires) {
+			delete(c.byID, id)
+		}
+	}
+	for client, entry := range c.self {
+		if !now.Before(entry.expires) {
+			delete(c.self, client)
+		}
+	}
+	c.swept = now
+}
+
+// knownID returns the ID of the user last known under login, however old for
+// configured logins.
+func (c *userCache) knownID(login string) (string, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entry, ok := c.byLogin[strings.ToLower(login)]
+	return entry.user.ID, ok
+}
+
+// store caches the users and returns the previous login of the users which
+// were known under another login, by ID.
+func (c *userCache) store(users []helix.User, now time.Time) map[string]string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if now.Sub(c.swept) >= *userCacheTTL {
+		c.sweep(now)
+	}
+
+	renamed := make(map[string]string)
+	expires := now.Add(*userCacheTTL)
+	for _, user := range users {
+		if previous, ok := c.byID[user.ID]; ok && !strings.EqualFold(previous.user.Login, user.Login) {
+			renamed[user.ID] = previous.user.Login
+		}
+
+		entry := cachedUser{user: user, expires: expires}
+		c.byLogin[strings.ToLower(user.Login)] = entry
+		c.byID[user.ID] = entry
+	}
+
+	return renamed
+}
+
+// alias caches user under a login which is not its own, so that a channel
+// configured with a previous login of the user keeps resolving to it.
+func (c *userCache) alias(login string, user helix.User, now time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.byLogin[strings.ToLower(login)] = cachedUser{user: user, expires: now.Add(*userCacheTTL)}
+}
+
+// beginSelf returns the token owner call in flight for client, or registers a
+// new one which the caller owns.
+func (c *userCache) beginSelf(client HelixClient) (call *userCall, owned bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if call, ok := c.inflightSelf[client]; ok {
+		return call, false
+	}
+	call = &userCall{done: make(chan struct{})}
+	c.inflightSelf[client] = call
+	return call, true
+}
+
+func (c *userCache) finishSelf(client HelixClient, call *userCall, err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	delete(c.inflightSelf, client)
+	call.err = err
+	close(call.done)
+}
+
+func (c *userCache) storeSelf(client HelixClient, user helix.User, now time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.self[client] = cachedUser{user: user, expires: now.Add(*userCacheTTL)}
+}
+
+// collect exposes the cache hit and miss counters.
+func (c *userCache) collect(ch chan<- prometheus.Metric) {
+	c.mtx.Lock()
+	hits, misses := c.hits, c.misses
+	c.mtx.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(userCacheHitsDesc, prometheus.CounterValue, hits)
+	ch <- prometheus.MustNewConstMetric(userCacheMissesDesc, prometheus.CounterValue, misses)
+}
+
+// getUsers resolves channel login names to Twitch user objects, using the
+// shared user cache and only requesting unknown or expired logins from the
+// API. When no logins are given, the user owning the client token is returned.
+// It returns an error if the API call fails or returns a non-200 status.
+func getUsers(client HelixClient, logger *slog.Logger, logins []string) ([]helix.User, error) {
+	if len(logins) == 0 {
+		return getSelf(client, logger)
+	}
+
+	found, err := getUsersBy(client, logger, logins, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return uniqueUsers(found), nil
+}
+
+// getSelf returns the user owning the token of client, concurrent lookups
+// share a single request.
+func getSelf(client HelixClient, logger *slog.Logger) ([]helix.User, error) {
+	now := time.Now()
+	if user, ok := users.lookupSelf(client, now); ok {
+		return []helix.User{user}, nil
+	}
+
+	call, owned := users.beginSelf(client)
+	if !owned {
+		<-call.done
+		if call.err != nil {
+			return nil, call.err
+		}
+		if user, ok := users.lookupSelf(client, time.Now()); ok {
+			return []helix.User{user}, nil
+		}
+		return nil, nil
+	}
+
+	fetched, err := requestUsers(client, logger, nil, nil)
+	if err == nil && len(fetched) > 0 {
+		users.storeSelf(client, fetched[0], now)
+	}
+	users.finishSelf(client, call, err)
+	if err != nil {
+		return nil, err
+	}
+	return fetched, nil
+}
+
+// getUsersBy resolves logins, or IDs if byID is set, to Twitch users keyed by
+// lowercase login or by ID, using the shared user cache. Concurrent lookups of
+// the same keys share a single request, and keys which did not resolve are
+// not requested again for a while.
+func getUsersBy(client HelixClient, logger *slog.Logger, keys []string, byID bool) (map[string]helix.User, error) {
+	now := time.Now()
+
+	found, missing := users.lookup(keys, byID, now)
+	if len(missing) == 0 {
+		return found, nil
+	}
+
+	call, owned, waits := users.begin(missing, byID)
+	err := fetchUsers(client, logger, owned, byID, now)
+	users.finish(call, owned, byID, err, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, other := range waits {
+		<-other.done
+		if other.err != nil {
+			return nil, other.err
+		}
+	}
+
+	maps.Copy(found, users.collected(missing, byID, time.Now()))
+	return found, nil
+}
+
+// fetchUsers requests the users of keys from the API, in batches, and caches
+// them.
+func fetchUsers(client HelixClient, logger *slog.Logger, keys []string, byID bool, now time.Time) error {
+	for len(keys) > 0 {
+		batch := keys[:min(len(keys), maxUsersPerRequest)]
+		keys = keys[len(batch):]
+
+		var fetched []helix.User
+		var err error
+		if byID {
+			fetched, err = requestUsers(client, logger, nil, batch)
+		} else {
+			fetched, err = requestUsers(client, logger, batch, nil)
+		}
+		if err != nil {
+			return err
+		}
+
+		for id, previous := range users.store(fetched, now) {
+			logger.Warn("channel renamed", "user_id", id, "previous_login", previous)
+		}
+	}
+	return nil
+}
+
+// resolveChannels resolves the channels, configured by login or by ID, to
+// Twitch users keyed by channel. Logins which no longer resolve are looked up
+// by the ID they were last known with, so that renamed channels keep being
+// monitored.
+func resolveChannels(client HelixClient, logger *slog.Logger, channelNames ChannelNames) (map[string]helix.User, error) {
+	logins, ids := channelNames.split()
+	resolved := make(map[string]helix.User, len(channelNames))
+
+	if len(logins) > 0 {
+		found, err := getUsersBy(client, logger, logins, false)
+		if err != nil {
+			return nil, err
+		}
+
+		previousLogins := make(map[string]string)
+		for _, login := range logins {
+			if user, ok := found[strings.ToLower(login)]; ok {
+				resolved[login] = user
+				continue
+			}
+			if id, ok := users.knownID(login); ok {
+				previousLogins[id] = login
+			}
+		}
+
+		if len(previousLogins) > 0 {
+			renamed, err := getUsersBy(client, logger, slices.Collect(maps.Keys(previousLogins)), true)
+			if err != nil {
+				return nil, err
+			}
+
+			now := time.Now()
+			for id, user := range renamed {
+				login := previousLogins[id]
+				logger.Warn("configured channel was renamed, configure it by its new login or its ID", "channel", login, "user_id", id, "login", user.Login)
+				users.alias(login, user, now)
+				resolved[login] = user
+			}
+		}
+	}
+
+	if len(ids) > 0 {
+		found, err := getUsersBy(client, logger, ids, true)
+		if err != nil {
+			return nil, err
+		}
+		for id, user := range found {
+			resolved[channelIDPrefix+id] = user
+		}
+	}
+
+	return resolved, nil
+}
+
+// uniqueUsers returns the users of found without duplicates, in a stable
+// order.
+func uniqueUsers(found map[string]helix.User) []helix.User {
+	byID := make(map[string]helix.User, len(found))
+	for _, user := range found {
+		byID[user.ID] = user
+	}
+
+	unique := make([]helix.User, 0, len(byID))
+	for _, id := range slices.Sorted(maps.Keys(byID)) {
+		unique = append(unique, byID[id])
+	}
+	return unique
+}
+
+// requestUsers requests users by login or by ID from the API without going
+// through the cache.
+func requestUsers(client HelixClient, logger *slog.Logger, logins, ids []string) ([]helix.User, error) {
+	resp, err := client.GetUsers(&helix.UsersParams{
+		Logins: logins,
+		IDs:    ids,
+	})
+	if err != nil {
+		logger.Error("Failed to collect users stats from Twitch helix API", "err", err)
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		logger.Error("Failed to collect users stats from Twitch helix API", "err", resp.ErrorMessage)
+		return nil, errors.New(resp.ErrorMessage)
+	}
+	return resp.Data.Users, nil
+}
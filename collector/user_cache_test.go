@@ -0,0 +1,155 @@
+package collector
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/damoun/twitch_exporter/internal/helixtest"
+	"github.com/nicklaw5/helix/v2"
+	"github.com/prometheus/common/promslog"
+)
+
+// blockingClient holds the users requests until released, counting them.
+type blockingClient struct {
+	HelixClient
+
+	requests atomic.Int32
+	entered  chan struct{}
+	release  chan struct{}
+}
+
+func (c *blockingClient) GetUsers(params *helix.UsersParams) (*helix.UsersResponse, error) {
+	if c.requests.Add(1) == 1 {
+		close(c.entered)
+	}
+	<-c.release
+	return c.HelixClient.GetUsers(params)
+}
+
+func newTestClient(t *testing.T) (*helixtest.Server, *helix.Client) {
+	t.Helper()
+
+	s := helixtest.NewServer()
+	t.Cleanup(s.Close)
+	client, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	users = newUserCache()
+	return s, client
+}
+
+func TestGetUsersCached(t *testing.T) {
+	s, client := newTestClient(t)
+	logger := promslog.NewNopLogger()
+
+	for range 3 {
+		found, err := getUsers(client, logger, []string{"Dam0un"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != 1 || found[0].ID != "1" {
+			t.Fatalf("unexpected users: %+v", found)
+		}
+	}
+	if n := s.Requests("/users"); n != 1 {
+		t.Errorf("expected 1 users request, got %d", n)
+	}
+}
+
+func TestGetUsersConcurrentLookupsShareRequest(t *testing.T) {
+	_, client := newTestClient(t)
+	blocking := &blockingClient{HelixClient: client, entered: make(chan struct{}), release: make(chan struct{})}
+	logger := promslog.NewNopLogger()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found, err := getUsers(blocking, logger, []string{"dam0un"})
+			if err == nil && len(found) != 1 {
+				t.Errorf("unexpected users: %+v", found)
+			}
+			errs <- err
+		}()
+	}
+
+	<-blocking.entered
+	// leave the other lookups time to join the request in flight
+	time.Sleep(50 * time.Millisecond)
+	close(blocking.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := blocking.requests.Load(); n != 1 {
+		t.Errorf("expected 1 users request, got %d", n)
+	}
+}
+
+func TestGetUsersNotFoundCached(t *testing.T) {
+	s, client := newTestClient(t)
+	s.Respond("/users?login=nobody", `{"data": []}`)
+	logger := promslog.NewNopLogger()
+
+	for range 3 {
+		found, err := getUsers(client, logger, []string{"nobody"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != 0 {
+			t.Fatalf("unexpected users: %+v", found)
+		}
+	}
+	if n := s.Requests("/users"); n != 1 {
+		t.Errorf("expected 1 users request, got %d", n)
+	}
+}
+
+func TestGetUsersErrorNotCached(t *testing.T) {
+	s, client := newTestClient(t)
+	s.Error("/users", 500, "Internal Server Error")
+	logger := promslog.NewNopLogger()
+
+	for range 2 {
+		if _, err := getUsers(client, logger, []string{"dam0un"}); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+	if n := s.Requests("/users"); n != 2 {
+		t.Errorf("expected 2 users requests, got %d", n)
+	}
+}
+
+func TestUserCacheSweepsExpiredUsers(t *testing.T) {
+	c := newUserCache()
+	c.configure(ChannelNames{"Dam0un", "id:4"})
+
+	now := time.Now()
+	c.store([]helix.User{{ID: "1", Login: "dam0un"}, {ID: "2", Login: "surdaft"}, {ID: "4", Login: "byid"}}, now)
+	c.store([]helix.User{{ID: "3", Login: "other"}}, now.Add(*userCacheTTL+time.Second))
+
+	// configured channels keep their history, to detect renames
+	if id, ok := c.knownID("dam0un"); !ok || id != "1" {
+		t.Error("expected the configured login to be kept")
+	}
+	for _, id := range []string{"1", "3", "4"} {
+		if _, ok := c.byID[id]; !ok {
+			t.Errorf("expected the user %s to be kept", id)
+		}
+	}
+	if _, ok := c.knownID("surdaft"); ok {
+		t.Error("expected the expired login to be swept")
+	}
+	if _, ok := c.byID["2"]; ok {
+		t.Error("expected the expired ID to be swept")
+	}
+}
@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/damoun/twitch_exporter/internal/eventsub"
+	"github.com/nicklaw5/helix/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type userInfoCollector struct {
+	logger       *slog.Logger
+	client       HelixClient
+	channelNames ChannelNames
+
+	userInfo             typedDesc
+	userCreatedTimestamp typedDesc
+}
+
+func init() {
+	registerCollector("user_info", defaultEnabled, 0, highPriority, anyToken, NewUserInfoCollector)
+}
+
+func NewUserInfoCollector(logger *slog.Logger, client HelixClient, _ *eventsub.Client, channels Channels) (Collector, error) {
+	c := userInfoCollector{
+		logger:       logger,
+		client:       client,
+		channelNames: channels.Names(),
+
+		userInfo: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "user", "info"),
+			"Profile of the broadcaster of a channel, the value is always 1.",
+			channels.labelNames("display_name", "broadcaster_type", "type"), nil,
+		), prometheus.GaugeValue, channels},
+		userCreatedTimestamp: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "user", "created_timestamp_seconds"),
+			"Unix timestamp of the creation of the account of the broadcaster of a channel.",
+			channels.labelNames(), nil,
+		), prometheus.GaugeValue, channels},
+	}
+
+	return c, nil
+}
+
+// Update exposes the users resolved from the channels, which are cached, so
+// it does not request the Twitch API any further.
+func (c userInfoCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	if len(c.channelNames) == 0 {
+		return ErrNoData
+	}
+
+	users, err := getChannelUsers(ctx, c.client, c.logger, c.channelNames)
+	if err != nil {
+		return err
+	}
+
+	return updateChannels(ctx, users, func(user helix.User) error {
+		ch <- c.userInfo.mustNewChannelMetric(1, user, user.DisplayName, user.BroadcasterType, user.Type)
+		if !user.CreatedAt.IsZero() {
+			ch <- c.userCreatedTimestamp.mustNewChannelMetric(float64(user.CreatedAt.Unix()), user)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,23 @@
+package collector
+
+import "testing"
+
+func TestUserInfo(t *testing.T) {
+	_, c := newTestCollector(t, "user_info")
+
+	expectMetrics(t, c, `
+# HELP twitch_user_created_timestamp_seconds Unix timestamp of the creation of the account of the broadcaster of a channel.
+# TYPE twitch_user_created_timestamp_seconds gauge
+twitch_user_created_timestamp_seconds{user_id="1",username="dam0un"} 1.481747548e+09
+# HELP twitch_user_info Profile of the broadcaster of a channel, the value is always 1.
+# TYPE twitch_user_info gauge
+twitch_user_info{broadcaster_type="affiliate",display_name="Dam0un",type="",user_id="1",username="dam0un"} 1
+`)
+}
+
+func TestUserInfoError(t *testing.T) {
+	s, c := newTestCollector(t, "user_info")
+	s.Error("/users", 500, "Internal Server Error")
+
+	expectUpdateError(t, c)
+}
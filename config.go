@@ -0,0 +1,231 @@
+// Copyright 2020 Damien PLÉNARD.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/damoun/twitch_exporter/collector"
+	"github.com/damoun/twitch_exporter/internal/config"
+	"github.com/damoun/twitch_exporter/internal/discovery"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	configFile = kingpin.Flag("config.file",
+		"Path of the YAML configuration file, reloaded on SIGHUP or on a POST request to /-/reload.").
+		Default("").String()
+
+	configReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "twitch_exporter",
+		Name:      "config_last_reload_successful",
+		Help:      "Whether the last configuration reload attempt was successful.",
+	})
+	configReloadSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "twitch_exporter",
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful configuration reload.",
+	})
+)
+
+// loadConfig loads the configuration file, or returns an empty configuration
+// when none is given.
+func loadConfig() (*config.Config, error) {
+	if *configFile == "" {
+		return &config.Config{}, nil
+	}
+	return config.Load(*configFile)
+}
+
+// applyStartupConfig overrides the credentials and EventSub flags with the
+// values of the configuration file. These settings are only read at startup.
+func applyStartupConfig(cfg *config.Config) {
+	overrideString(twitchClientID, cfg.Credentials.ClientID)
+	overrideString(twitchClientSecret, cfg.Credentials.ClientSecret)
+	overrideString(twitchAccessToken, cfg.Credentials.AccessToken)
+	overrideString(twitchAccessTokenFile, cfg.Credentials.AccessTokenFile)
+	overrideString(twitchRefreshToken, cfg.Credentials.RefreshToken)
+	overrideString(twitchRefreshTokenFile, cfg.Credentials.RefreshTokenFile)
+	overrideString(twitchTokenStateFile, cfg.Credentials.TokenStateFile)
+
+	if cfg.EventSub.Enabled != nil {
+		*eventSubEnabled = *cfg.EventSub.Enabled
+	}
+	overrideString(eventSubWebhookURL, cfg.EventSub.WebhookURL)
+	overrideString(eventSubWebhookSecret, cfg.EventSub.WebhookSecret)
+}
+
+func overrideString(flag *string, value string) {
+	if value != "" {
+		*flag = value
+	}
+}
+
+// collectorConfig returns the channels and collectors settings of the
+// configuration file, the channels are added to the --twitch.channel flags.
+func collectorConfig(cfg *config.Config) collector.Config {
+	channels := make(collector.Channels, 0, len(cfg.Channels))
+	for _, channel := range cfg.Channels {
+		channels = append(channels, collector.Channel{
+			Name:              channel.Name,
+			Labels:            channel.Labels,
+			IncludeCollectors: channel.IncludeCollectors,
+			ExcludeCollectors: channel.ExcludeCollectors,
+		})
+	}
+	channels = mergeChannels(twitchChannel.Channels(), channels)
+
+	collectors := make(map[string]collector.CollectorConfig, len(cfg.Collectors))
+	for name, c := range cfg.Collectors {
+		collectors[name] = collector.CollectorConfig{
+			Enabled:  c.Enabled,
+			Interval: time.Duration(c.Interval),
+		}
+	}
+
+	return collector.Config{Channels: channels, Collectors: collectors}
+}
+
+// mergeChannels returns the channels of a followed by the channels of b which
+// are not in a, ignoring case. A channel of a without any setting, e.g. given
+// with --twitch.channel, takes the settings of the same channel in b.
+func mergeChannels(a, b collector.Channels) collector.Channels {
+	var channels collector.Channels
+	seen := make(map[string]int)
+	for _, channel := range append(append(collector.Channels{}, a...), b...) {
+		login := strings.ToLower(channel.Name)
+		if i, ok := seen[login]; ok {
+			if isBare(channels[i]) {
+				channel.Name = channels[i].Name
+				channels[i] = channel
+			}
+			continue
+		}
+		seen[login] = len(channels)
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// isBare returns whether the channel has no setting other than its name.
+func isBare(channel collector.Channel) bool {
+	return len(channel.Labels) == 0 && len(channel.IncludeCollectors) == 0 && len(channel.ExcludeCollectors) == 0
+}
+
+// configReloader reloads the configuration file into the running exporter,
+// along with the channels found by the discovery manager.
+type configReloader struct {
+	logger    *slog.Logger
+	exporter  *collector.Exporter
+	discovery *discovery.Manager
+	scopes    *scopeChecker
+	// startup is the configuration loaded at startup, changes of the settings
+	// which can't be reloaded are reported against it.
+	startup *config.Config
+
+	mtx sync.Mutex
+	// static is the configuration last loaded from the flags and the
+	// configuration file, without the discovered channels.
+	static collector.Config
+}
+
+// withDiscovered returns cfg with the channels found by the discovery manager
+// added to its channels.
+func withDiscovered(cfg collector.Config, m *discovery.Manager) collector.Config {
+	var discovered collector.Channels
+	for _, channel := range m.Channels() {
+		discovered = append(discovered, collector.Channel{Name: channel.Name, Labels: channel.Labels})
+	}
+	cfg.Channels = mergeChannels(cfg.Channels, discovered)
+	return cfg
+}
+
+func (c *configReloader) reload() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	err := c.apply()
+	if err != nil {
+		c.logger.Error("Error reloading the configuration", "file", *configFile, "err", err)
+		configReloadSuccess.Set(0)
+		return err
+	}
+
+	c.logger.Info("Configuration reloaded", "file", *configFile)
+	configReloadSuccess.Set(1)
+	configReloadSeconds.SetToCurrentTime()
+	return nil
+}
+
+func (c *configReloader) apply() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(cfg.Credentials, c.startup.Credentials) || !reflect.DeepEqual(cfg.EventSub, c.startup.EventSub) {
+		c.logger.Warn("Credentials and EventSub settings are only applied on restart")
+	}
+
+	static := collectorConfig(cfg)
+	checked, err := c.scopes.check(withDiscovered(static, c.discovery))
+	if err != nil {
+		return err
+	}
+	if err := c.exporter.ApplyConfig(checked); err != nil {
+		return err
+	}
+	c.static = static
+	return nil
+}
+
+// reapply applies the configuration last loaded again, along with the
+// channels found by the discovery manager, once they changed or a token did.
+func (c *configReloader) reapply() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	checked, err := c.scopes.check(withDiscovered(c.static, c.discovery))
+	if err != nil {
+		c.logger.Error("Error applying the configuration", "err", err)
+		return
+	}
+	if err := c.exporter.ApplyConfig(checked); err != nil {
+		c.logger.Error("Error applying the configuration", "err", err)
+	}
+}
+
+// watchSignals reloads the configuration on every SIGHUP.
+func (c *configReloader) watchSignals() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			_ = c.reload()
+		}
+	}()
+}
+
+// handler reloads the configuration on POST and PUT requests.
+func (c *configReloader) handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, "Only POST or PUT requests allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := c.reload(); err != nil {
+		http.Error(w, "Failed to reload config: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2020 Damien PLÉNARD.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/damoun/twitch_exporter/collector"
+	"github.com/damoun/twitch_exporter/internal/discovery"
+	"github.com/damoun/twitch_exporter/internal/helixtest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promslog"
+)
+
+func TestMain(m *testing.M) {
+	// flags only hold their default values once parsed
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// discoveredChannels is a discovery source of fixed channels.
+type discoveredChannels []discovery.Channel
+
+func (s discoveredChannels) Discover(_ context.Context) ([]discovery.Channel, error) {
+	return s, nil
+}
+
+func TestWithDiscovered(t *testing.T) {
+	m := discovery.NewManager(promslog.NewNopLogger(), 0)
+	m.Add("team", discoveredChannels{
+		{Name: "dam0un", Labels: map[string]string{"team": "exporters"}},
+		{Name: "surdaft", Labels: map[string]string{"team": "exporters"}},
+		{Name: "other"},
+	})
+	m.Refresh(context.Background())
+
+	static := collector.Config{Channels: collector.Channels{
+		{Name: "Dam0un", ExcludeCollectors: []string{"channel_clips_total"}},
+		{Name: "surdaft"},
+	}}
+
+	expected := collector.Channels{
+		// configured channels keep their settings
+		{Name: "Dam0un", ExcludeCollectors: []string{"channel_clips_total"}},
+		// channels configured by name only get the discovered labels
+		{Name: "surdaft", Labels: map[string]string{"team": "exporters"}},
+		{Name: "other"},
+	}
+	if got := withDiscovered(static, m).Channels; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected channels %+v, got %+v", expected, got)
+	}
+	if len(static.Channels) != 2 {
+		t.Errorf("expected the static channels to be left unchanged, got %+v", static.Channels)
+	}
+}
+
+func TestMergeChannels(t *testing.T) {
+	flags := collector.ChannelNames{"Dam0un", "surdaft"}.Channels()
+	file := collector.Channels{
+		{Name: "dam0un", Labels: map[string]string{"team": "exporters"}},
+		{Name: "SURDAFT", IncludeCollectors: []string{"channel_subscribers_total"}},
+		{Name: "other"},
+		{Name: "Other", Labels: map[string]string{"team": "friends"}},
+	}
+
+	expected := collector.Channels{
+		// flag channels take the settings of the file, keeping their name
+		{Name: "Dam0un", Labels: map[string]string{"team": "exporters"}},
+		{Name: "surdaft", IncludeCollectors: []string{"channel_subscribers_total"}},
+		// a channel without settings takes the ones of the same channel
+		// given later
+		{Name: "other", Labels: map[string]string{"team": "friends"}},
+	}
+	if got := mergeChannels(flags, file); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected channels %+v, got %+v", expected, got)
+	}
+}
+
+// newTestReloader returns a reloader of the configuration file at path into an
+// exporter created from it.
+func newTestReloader(t *testing.T, path string) *configReloader {
+	t.Helper()
+
+	previousFile, previousClientID := *configFile, *twitchClientID
+	*configFile, *twitchClientID = path, helixtest.ClientID
+	t.Cleanup(func() { *configFile, *twitchClientID = previousFile, previousClientID })
+
+	s := helixtest.NewServer()
+	t.Cleanup(s.Close)
+	client, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := promslog.NewNopLogger()
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	static := collectorConfig(cfg)
+	exporter, err := collector.NewExporterWithConfig(logger, client, nil, static)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := newTokenValidator(logger, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &configReloader{
+		logger:    logger,
+		exporter:  exporter,
+		discovery: discovery.NewManager(logger, 0),
+		scopes:    newScopeChecker(logger, tokens, "app", nil),
+		startup:   cfg,
+		static:    static,
+	}
+}
+
+func writeConfigFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func channelNames(cfg collector.Config) []string {
+	var names []string
+	for _, channel := range cfg.Channels {
+		names = append(names, channel.Name)
+	}
+	return names
+}
+
+func TestConfigReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfigFile(t, path, "channels: [dam0un]\n")
+	reloader := newTestReloader(t, path)
+
+	writeConfigFile(t, path, `
+channels:
+  - dam0un
+  - name: surdaft
+    labels: {team: exporters}
+`)
+	if err := reloader.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := channelNames(reloader.exporter.Config()); !reflect.DeepEqual(got, []string{"dam0un", "surdaft"}) {
+		t.Errorf("expected the reloaded channels, got %v", got)
+	}
+	if got := testutil.ToFloat64(configReloadSuccess); got != 1 {
+		t.Errorf("expected a successful reload, got %v", got)
+	}
+}
+
+func TestConfigReloadInvalidKeepsConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+	}{
+		{name: "invalid syntax", content: "channels: [dam0un\n"},
+		{name: "unknown collector", content: "channels: [dam0un]\ncollectors:\n  missing:\n    enabled: true\n"},
+		{name: "invalid label name", content: "channels:\n  - name: dam0un\n    labels: {__name__: x}\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yml")
+			writeConfigFile(t, path, "channels: [dam0un, surdaft]\n")
+			reloader := newTestReloader(t, path)
+
+			writeConfigFile(t, path, tc.content)
+			if err := reloader.reload(); err == nil {
+				t.Fatal("expected the reload to fail")
+			}
+			if got := channelNames(reloader.exporter.Config()); !reflect.DeepEqual(got, []string{"dam0un", "surdaft"}) {
+				t.Errorf("expected the previous channels to be kept, got %v", got)
+			}
+			if got := testutil.ToFloat64(configReloadSuccess); got != 0 {
+				t.Errorf("expected a failed reload, got %v", got)
+			}
+		})
+	}
+}
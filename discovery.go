@@ -0,0 +1,81 @@
+// Copyright 2020 Damien PLÉNARD.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/damoun/twitch_exporter/collector"
+	"github.com/damoun/twitch_exporter/internal/discovery"
+	"github.com/nicklaw5/helix/v2"
+)
+
+var (
+	discoveryInterval = kingpin.Flag("twitch.discovery-interval",
+		"Interval at which discovered channels are refreshed.").
+		Default("5m").Duration()
+
+	gameNames = kingpin.Flag("twitch.game",
+		"Name of a game or category whose top live channels are monitored.").Strings()
+	gameIDs = kingpin.Flag("twitch.game-id",
+		"ID of a game or category whose top live channels are monitored.").Strings()
+	gameLanguages = kingpin.Flag("twitch.game-language",
+		"Language of the live channels discovered by game, all languages when not set.").Strings()
+	gameLimit = kingpin.Flag("twitch.game-limit",
+		"Maximum number of live channels discovered by game.").
+		Default("100").Int()
+	gameMinViewers = kingpin.Flag("twitch.game-min-viewers",
+		"Minimum number of viewers of the live channels discovered by game.").
+		Default("0").Int()
+
+	teams = kingpin.Flag("twitch.team",
+		"Name of a Twitch team whose members are monitored.").Strings()
+
+	followedChannels = kingpin.Flag("twitch.followed-channels",
+		"Monitor every channel followed by the owner of the user access token, which requires the user:read:follows scope.").
+		Default("false").Bool()
+
+	channelsFile = kingpin.Flag("twitch.channels-file",
+		"Path of a JSON or YAML file listing channels to monitor with their labels, in the format of the Prometheus file_sd. Changes are picked up automatically.").
+		Default("").String()
+)
+
+// newDiscoveryManager creates the discovery manager with a source for every
+// discovery flag set.
+func newDiscoveryManager(logger *slog.Logger, client *helix.Client, httpClient helix.HTTPClient) (*discovery.Manager, error) {
+	m := discovery.NewManager(logger, *discoveryInterval)
+
+	if len(*gameNames) > 0 || len(*gameIDs) > 0 {
+		logger.Info("discovering channels by game", "games", *gameNames, "game_ids", *gameIDs, "limit", *gameLimit)
+		m.Add("game", discovery.NewGameSource(client, logger, *gameIDs, *gameNames, *gameLanguages, *gameLimit, *gameMinViewers))
+	}
+
+	if len(*teams) > 0 {
+		logger.Info("discovering channels by team", "teams", *teams)
+		teamsClient := discovery.NewTeamsClient(httpClient, helix.DefaultAPIBaseURL, *twitchClientID, func() string {
+			if token := client.GetUserAccessToken(); token != "" {
+				return token
+			}
+			return client.GetAppAccessToken()
+		})
+		m.Add("team", discovery.NewTeamSource(teamsClient, logger, *teams, collector.LegacyUsernameLabel()))
+	}
+
+	if *followedChannels {
+		if client.GetUserAccessToken() == "" {
+			return nil, errors.New("discovering followed channels requires a user access token")
+		}
+		logger.Info("discovering followed channels")
+		m.Add("followed", discovery.NewFollowedSource(client))
+	}
+
+	if *channelsFile != "" {
+		logger.Info("discovering channels from file", "file", *channelsFile)
+		m.Add("file", discovery.NewFileSource(logger, *channelsFile))
+	}
+
+	return m, nil
+}
@@ -0,0 +1,135 @@
+// Package config loads the YAML configuration file of the exporter.
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"go.yaml.in/yaml/v2"
+)
+
+// Config is the content of the configuration file. Every setting is optional
+// and takes precedence over the matching command line flag.
+type Config struct {
+	// Channels are monitored in addition to the --twitch.channel flags.
+	Channels    []Channel                  `yaml:"channels"`
+	Collectors  map[string]CollectorConfig `yaml:"collectors"`
+	Credentials CredentialsConfig          `yaml:"credentials"`
+	EventSub    EventSubConfig             `yaml:"eventsub"`
+}
+
+// Channel is a channel to monitor along with the labels added to all its
+// metrics and the collectors run for it. It is given either as its name or as
+// a mapping with a name and settings.
+type Channel struct {
+	Name   string            `yaml:"name"`
+	Labels map[string]string `yaml:"labels"`
+	// IncludeCollectors are run for this channel even if they are disabled,
+	// ExcludeCollectors are not run for this channel even if they are enabled.
+	IncludeCollectors []string `yaml:"include_collectors"`
+	ExcludeCollectors []string `yaml:"exclude_collectors"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *Channel) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&c.Name); err == nil {
+		return nil
+	}
+
+	type plain Channel
+	return unmarshal((*plain)(c))
+}
+
+// CollectorConfig overrides the --collector.<name> flags of a collector.
+type CollectorConfig struct {
+	Enabled  *bool          `yaml:"enabled"`
+	Interval model.Duration `yaml:"interval"`
+}
+
+// CredentialsConfig holds the Twitch application and user tokens. Secrets can
+// be given directly or as the path of a file containing them.
+type CredentialsConfig struct {
+	ClientID         string `yaml:"client_id"`
+	ClientSecret     string `yaml:"client_secret"`
+	ClientSecretFile string `yaml:"client_secret_file"`
+	AccessToken      string `yaml:"access_token"`
+	AccessTokenFile  string `yaml:"access_token_file"`
+	RefreshToken     string `yaml:"refresh_token"`
+	RefreshTokenFile string `yaml:"refresh_token_file"`
+	TokenStateFile   string `yaml:"token_state_file"`
+	// Channels maps channels to the user token of their broadcaster, which
+	// is used for the requests of that broadcaster.
+	Channels map[string]TokenConfig `yaml:"channels"`
+}
+
+// TokenConfig is the user token of a broadcaster.
+type TokenConfig struct {
+	AccessToken      string `yaml:"access_token"`
+	AccessTokenFile  string `yaml:"access_token_file"`
+	RefreshToken     string `yaml:"refresh_token"`
+	RefreshTokenFile string `yaml:"refresh_token_file"`
+	StateFile        string `yaml:"state_file"`
+}
+
+// EventSubConfig configures the Twitch EventSub webhooks.
+type EventSubConfig struct {
+	Enabled           *bool  `yaml:"enabled"`
+	WebhookURL        string `yaml:"webhook_url"`
+	WebhookSecret     string `yaml:"webhook_secret"`
+	WebhookSecretFile string `yaml:"webhook_secret_file"`
+}
+
+// Load reads and validates the configuration file at path. Secrets given as
+// files, other than the user tokens which are read by the client on every
+// refresh, are resolved into their direct value.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	for i, channel := range cfg.Channels {
+		channel.Name = strings.TrimSpace(channel.Name)
+		if channel.Name == "" {
+			return nil, fmt.Errorf("channel %d: empty channel name", i)
+		}
+		cfg.Channels[i] = channel
+	}
+
+	for channel, token := range cfg.Credentials.Channels {
+		hasAccessToken := token.AccessToken != "" || token.AccessTokenFile != ""
+		hasRefreshToken := token.RefreshToken != "" || token.RefreshTokenFile != ""
+		if !hasAccessToken || !hasRefreshToken {
+			return nil, fmt.Errorf("credentials of channel %s: access and refresh tokens are required", channel)
+		}
+	}
+
+	if cfg.Credentials.ClientSecretFile != "" {
+		if cfg.Credentials.ClientSecret, err = readSecret(cfg.Credentials.ClientSecretFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.EventSub.WebhookSecretFile != "" {
+		if cfg.EventSub.WebhookSecret, err = readSecret(cfg.EventSub.WebhookSecretFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,236 @@
+// Package discovery periodically discovers the Twitch channels to monitor,
+// in addition to the channels configured statically.
+package discovery
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nicklaw5/helix/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "twitch"
+
+// HelixClient is the subset of the helix client used by the sources.
+type HelixClient interface {
+	GetFollowedChannels(params *helix.GetFollowedChannelParams) (*helix.GetFollowedChannelResponse, error)
+	GetGames(params *helix.GamesParams) (*helix.GamesResponse, error)
+	GetStreams(params *helix.StreamsParams) (*helix.StreamsResponse, error)
+	GetUsers(params *helix.UsersParams) (*helix.UsersResponse, error)
+}
+
+// Channel is a discovered channel, along with the labels added to all its
+// metrics.
+type Channel struct {
+	Name   string
+	Labels map[string]string
+}
+
+// channelsOf returns the channels with the given logins, without labels.
+func channelsOf(logins []string) []Channel {
+	channels := make([]Channel, 0, len(logins))
+	for _, login := range logins {
+		channels = append(channels, Channel{Name: login})
+	}
+	return channels
+}
+
+// Source discovers channels to monitor.
+type Source interface {
+	// Discover returns the channels currently discovered.
+	Discover(ctx context.Context) ([]Channel, error)
+}
+
+// Watcher is implemented by the sources which detect their own changes, they
+// are then refreshed right away rather than at the next interval.
+type Watcher interface {
+	// Watch calls changed whenever the source changed, until ctx is done.
+	Watch(ctx context.Context, changed func())
+}
+
+// Manager refreshes its sources periodically and keeps the channels they
+// discovered. It implements prometheus.Collector, also collecting the metrics
+// of the sources implementing it.
+type Manager struct {
+	logger   *slog.Logger
+	interval time.Duration
+	sources  map[string]Source
+
+	mtx      sync.Mutex
+	channels map[string][]Channel
+
+	discovered       *prometheus.GaugeVec
+	refreshSuccess   *prometheus.GaugeVec
+	refreshTimestamp *prometheus.GaugeVec
+}
+
+// NewManager creates a manager refreshing its sources once per interval.
+func NewManager(logger *slog.Logger, interval time.Duration) *Manager {
+	return &Manager{
+		logger:   logger,
+		interval: interval,
+		sources:  make(map[string]Source),
+		channels: make(map[string][]Channel),
+		discovered: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "discovery",
+			Name:      "channels",
+			Help:      "Number of channels discovered by a source.",
+		}, []string{"source"}),
+		refreshSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "discovery",
+			Name:      "last_refresh_successful",
+			Help:      "Whether the last refresh of a source was successful.",
+		}, []string{"source"}),
+		refreshTimestamp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "discovery",
+			Name:      "last_refresh_success_timestamp_seconds",
+			Help:      "Timestamp of the last successful refresh of a source.",
+		}, []string{"source"}),
+	}
+}
+
+// Add registers a source under the given name.
+func (m *Manager) Add(name string, s Source) {
+	m.sources[name] = s
+}
+
+// Enabled returns whether any source has been registered.
+func (m *Manager) Enabled() bool {
+	return len(m.sources) > 0
+}
+
+// Refresh refreshes every source once and returns whether the discovered
+// channels changed. A failing source keeps its previously discovered channels.
+func (m *Manager) Refresh(ctx context.Context) bool {
+	var changed bool
+	for name, s := range m.sources {
+		if m.refresh(ctx, name, s) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// refresh refreshes a single source and returns whether its channels changed.
+func (m *Manager) refresh(ctx context.Context, name string, s Source) bool {
+	channels, err := s.Discover(ctx)
+	if err != nil {
+		m.logger.Error("Error discovering channels", "source", name, "err", err)
+		m.refreshSuccess.WithLabelValues(name).Set(0)
+		return false
+	}
+	m.refreshSuccess.WithLabelValues(name).Set(1)
+	m.refreshTimestamp.WithLabelValues(name).SetToCurrentTime()
+	m.discovered.WithLabelValues(name).Set(float64(len(channels)))
+
+	slices.SortFunc(channels, func(a, b Channel) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if slices.EqualFunc(m.channels[name], channels, func(a, b Channel) bool {
+		return a.Name == b.Name && maps.Equal(a.Labels, b.Labels)
+	}) {
+		return false
+	}
+	m.logger.Info("discovered channels changed", "source", name, "channels", len(channels))
+	m.channels[name] = channels
+	return true
+}
+
+// Run refreshes the sources once per interval, and the watchers whenever
+// they changed, until ctx is done, calling onChange whenever the discovered
+// channels changed.
+func (m *Manager) Run(ctx context.Context, onChange func()) {
+	if !m.Enabled() {
+		return
+	}
+
+	for name, s := range m.sources {
+		if w, ok := s.(Watcher); ok {
+			go w.Watch(ctx, func() {
+				if m.refresh(ctx, name, s) {
+					onChange()
+				}
+			})
+		}
+	}
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if m.Refresh(ctx) {
+				onChange()
+			}
+		}
+	}
+}
+
+// Channels returns the channels discovered by every source, without
+// duplicates. A channel discovered by several sources gets the labels of the
+// first source, by name, discovering it with labels.
+func (m *Manager) Channels() []Channel {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var channels []Channel
+	seen := make(map[string]int)
+	for _, name := range slices.Sorted(maps.Keys(m.channels)) {
+		for _, channel := range m.channels[name] {
+			login := strings.ToLower(channel.Name)
+			if i, ok := seen[login]; ok {
+				if len(channels[i].Labels) == 0 {
+					channels[i].Labels = channel.Labels
+				}
+				continue
+			}
+			seen[login] = len(channels)
+			channels = append(channels, Channel{Name: login, Labels: channel.Labels})
+		}
+	}
+	slices.SortFunc(channels, func(a, b Channel) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return channels
+}
+
+// Describe implements prometheus.Collector.
+func (m *Manager) Describe(ch chan<- *prometheus.Desc) {
+	m.discovered.Describe(ch)
+	m.refreshSuccess.Describe(ch)
+	m.refreshTimestamp.Describe(ch)
+	for _, s := range m.sources {
+		if c, ok := s.(prometheus.Collector); ok {
+			c.Describe(ch)
+		}
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (m *Manager) Collect(ch chan<- prometheus.Metric) {
+	m.discovered.Collect(ch)
+	m.refreshSuccess.Collect(ch)
+	m.refreshTimestamp.Collect(ch)
+	for _, s := range m.sources {
+		if c, ok := s.(prometheus.Collector); ok {
+			c.Collect(ch)
+		}
+	}
+}
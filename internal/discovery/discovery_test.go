@@ -0,0 +1,79 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/damoun/twitch_exporter/internal/helixtest"
+	"github.com/nicklaw5/helix/v2"
+	"github.com/prometheus/common/promslog"
+)
+
+func newTestClient(t *testing.T) (*helixtest.Server, *helix.Client) {
+	t.Helper()
+
+	s := helixtest.NewServer()
+	t.Cleanup(s.Close)
+	client, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, client
+}
+
+// fakeSource discovers fixed channels, or fails with err.
+type fakeSource struct {
+	channels []Channel
+	err      error
+}
+
+func (s *fakeSource) Discover(_ context.Context) ([]Channel, error) {
+	return append([]Channel{}, s.channels...), s.err
+}
+
+func expectChannels(t *testing.T, got []Channel, expected ...Channel) {
+	t.Helper()
+
+	if len(got) == 0 && len(expected) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected channels %+v, got %+v", expected, got)
+	}
+}
+
+func TestManagerMergesSources(t *testing.T) {
+	m := NewManager(promslog.NewNopLogger(), 0)
+	m.Add("followed", &fakeSource{channels: []Channel{{Name: "Dam0un"}, {Name: "surdaft"}}})
+	m.Add("team", &fakeSource{channels: []Channel{
+		{Name: "surdaft", Labels: map[string]string{"team": "exporters"}},
+		{Name: "dam0un"},
+	}})
+
+	if !m.Refresh(context.Background()) {
+		t.Error("expected the first refresh to change the channels")
+	}
+	expectChannels(t, m.Channels(),
+		Channel{Name: "dam0un"},
+		Channel{Name: "surdaft", Labels: map[string]string{"team": "exporters"}},
+	)
+
+	if m.Refresh(context.Background()) {
+		t.Error("expected the channels to be unchanged")
+	}
+}
+
+func TestManagerKeepsChannelsOfFailingSource(t *testing.T) {
+	source := &fakeSource{channels: []Channel{{Name: "dam0un"}}}
+	m := NewManager(promslog.NewNopLogger(), 0)
+	m.Add("game", source)
+	m.Refresh(context.Background())
+
+	source.err = errors.New("unavailable")
+	if m.Refresh(context.Background()) {
+		t.Error("expected a failing source not to change the channels")
+	}
+	expectChannels(t, m.Channels(), Channel{Name: "dam0un"})
+}
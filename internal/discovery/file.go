@@ -0,0 +1,208 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.yaml.in/yaml/v2"
+)
+
+// fileCheckInterval is the interval at which the file of a FileSource is
+// checked for changes.
+const fileCheckInterval = 5 * time.Second
+
+var (
+	fileReadErrorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "discovery", "file_read_errors_total"),
+		"Number of errors reading or parsing the channels file.",
+		[]string{"filename"}, nil,
+	)
+	fileMtimeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "discovery", "file_mtime_seconds"),
+		"Modification time of the channels file last loaded.",
+		[]string{"filename"}, nil,
+	)
+	fileLastLoadSuccessfulDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "discovery", "file_last_load_successful"),
+		"Whether the last attempt to load the channels file succeeded.",
+		[]string{"filename"}, nil,
+	)
+	fileLastLoadSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "discovery", "file_last_load_success_timestamp_seconds"),
+		"Timestamp of the last successful load of the channels file.",
+		[]string{"filename"}, nil,
+	)
+)
+
+// fileGroup is a group of channels of the channels file sharing the same
+// labels, like a target group of the Prometheus file_sd.
+type fileGroup struct {
+	Targets []string          `yaml:"targets"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+// FileSource discovers the channels listed in a JSON or YAML file, in the
+// format of the Prometheus file_sd: a list of groups, each with the channels
+// as targets and the labels added to their metrics. The file is checked for
+// changes every few seconds. It implements prometheus.Collector, exposing the
+// read errors, the outcome of the last load and the modification time of the
+// file last loaded.
+type FileSource struct {
+	logger *slog.Logger
+	path   string
+
+	mtx sync.Mutex
+	// modTime and size are the ones of the file last read, successfully or
+	// not, so that a broken file is only read again once it changed.
+	modTime    time.Time
+	size       int64
+	loaded     time.Time
+	readErrors int
+	// attempted is set once the file was loaded, successfully or not, failed
+	// tells whether the last load failed and lastSuccess when the last
+	// successful one happened.
+	attempted   bool
+	failed      bool
+	lastSuccess time.Time
+}
+
+// NewFileSource creates a source discovering the channels of the file at
+// path.
+func NewFileSource(logger *slog.Logger, path string) *FileSource {
+	return &FileSource{logger: logger, path: path}
+}
+
+// Discover implements Source.
+func (s *FileSource) Discover(_ context.Context) ([]Channel, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.attempted, s.failed = true, true
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		s.readErrors++
+		return nil, err
+	}
+	s.modTime, s.size = info.ModTime(), info.Size()
+
+	channels, err := s.read()
+	if err != nil {
+		s.readErrors++
+		return nil, err
+	}
+	s.loaded = info.ModTime()
+	s.failed, s.lastSuccess = false, time.Now()
+	return channels, nil
+}
+
+func (s *FileSource) read() ([]Channel, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML being a superset of JSON, JSON files are parsed the same way
+	var groups []fileGroup
+	if err := yaml.UnmarshalStrict(data, &groups); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", s.path, err)
+	}
+
+	var (
+		channels  []Channel
+		labelKeys []string
+		seen      = make(map[string]bool)
+	)
+	for i, group := range groups {
+		if len(group.Labels) > 0 {
+			keys := slices.Sorted(maps.Keys(group.Labels))
+			if labelKeys == nil {
+				labelKeys = keys
+			} else if !slices.Equal(keys, labelKeys) {
+				return nil, fmt.Errorf("%s: group %d has labels %v instead of %v, all groups with labels must have the same labels",
+					s.path, i, keys, labelKeys)
+			}
+		}
+
+		for _, target := range group.Targets {
+			login := strings.ToLower(strings.TrimSpace(target))
+			if login == "" {
+				return nil, fmt.Errorf("%s: group %d: empty channel name", s.path, i)
+			}
+			if seen[login] {
+				s.logger.Warn("channel listed twice in the channels file, only the first one is used", "file", s.path, "channel", login)
+				continue
+			}
+			seen[login] = true
+			channels = append(channels, Channel{Name: login, Labels: group.Labels})
+		}
+	}
+
+	return channels, nil
+}
+
+// Watch implements Watcher, changes are detected by checking the modification
+// time and size of the file.
+func (s *FileSource) Watch(ctx context.Context, changed func()) {
+	ticker := time.NewTicker(fileCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(s.path)
+			if err != nil {
+				// the error is reported by the next refresh
+				continue
+			}
+
+			s.mtx.Lock()
+			modified := !info.ModTime().Equal(s.modTime) || info.Size() != s.size
+			s.mtx.Unlock()
+
+			if modified {
+				s.logger.Info("channels file changed", "file", s.path)
+				changed()
+			}
+		}
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (s *FileSource) Describe(ch chan<- *prometheus.Desc) {
+	ch <- fileReadErrorsDesc
+	ch <- fileMtimeDesc
+	ch <- fileLastLoadSuccessfulDesc
+	ch <- fileLastLoadSuccessDesc
+}
+
+// Collect implements prometheus.Collector.
+func (s *FileSource) Collect(ch chan<- prometheus.Metric) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(fileReadErrorsDesc, prometheus.CounterValue, float64(s.readErrors), s.path)
+	if !s.loaded.IsZero() {
+		ch <- prometheus.MustNewConstMetric(fileMtimeDesc, prometheus.GaugeValue, float64(s.loaded.Unix()), s.path)
+	}
+	if s.attempted {
+		successful := 1.0
+		if s.failed {
+			successful = 0
+		}
+		ch <- prometheus.MustNewConstMetric(fileLastLoadSuccessfulDesc, prometheus.GaugeValue, successful, s.path)
+	}
+	if !s.lastSuccess.IsZero() {
+		ch <- prometheus.MustNewConstMetric(fileLastLoadSuccessDesc, prometheus.GaugeValue, float64(s.lastSuccess.Unix()), s.path)
+	}
+}
@@ -0,0 +1,124 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promslog"
+)
+
+func writeChannelsFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectFileMetrics(t *testing.T, s *FileSource, readErrors, successful string) {
+	t.Helper()
+
+	expected := `
+# HELP twitch_discovery_file_last_load_successful Whether the last attempt to load the channels file succeeded.
+# TYPE twitch_discovery_file_last_load_successful gauge
+twitch_discovery_file_last_load_successful{filename="` + s.path + `"} ` + successful + `
+# HELP twitch_discovery_file_read_errors_total Number of errors reading or parsing the channels file.
+# TYPE twitch_discovery_file_read_errors_total counter
+twitch_discovery_file_read_errors_total{filename="` + s.path + `"} ` + readErrors + `
+`
+	if err := testutil.CollectAndCompare(s, strings.NewReader(expected),
+		"twitch_discovery_file_last_load_successful", "twitch_discovery_file_read_errors_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFileSourceReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "channels.yml")
+	writeChannelsFile(t, path, `
+- targets: [Dam0un, surdaft, dam0un]
+  labels:
+    team: exporters
+- targets: [other]
+`)
+
+	source := NewFileSource(promslog.NewNopLogger(), path)
+	channels, err := source.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]string{"team": "exporters"}
+	expectChannels(t, channels,
+		Channel{Name: "dam0un", Labels: labels},
+		Channel{Name: "surdaft", Labels: labels},
+		Channel{Name: "other"},
+	)
+
+	// JSON files are read as well
+	writeChannelsFile(t, path, `[{"targets": ["surdaft"]}]`)
+	channels, err = source.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectChannels(t, channels, Channel{Name: "surdaft"})
+	expectFileMetrics(t, source, "0", "1")
+}
+
+func TestFileSourceInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+	}{
+		{name: "invalid syntax", content: `- targets: [dam0un`},
+		{name: "unknown field", content: `- channels: [dam0un]`},
+		{name: "empty channel", content: `- targets: [dam0un, " "]`},
+		{name: "different labels", content: `
+- targets: [dam0un]
+  labels: {team: exporters}
+- targets: [surdaft]
+  labels: {region: eu}
+`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "channels.yml")
+			writeChannelsFile(t, path, `- targets: [dam0un]`)
+
+			source := NewFileSource(promslog.NewNopLogger(), path)
+			if _, err := source.Discover(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			writeChannelsFile(t, path, tc.content)
+			if _, err := source.Discover(context.Background()); err == nil {
+				t.Error("expected an error")
+			}
+			expectFileMetrics(t, source, "1", "0")
+		})
+	}
+}
+
+func TestFileSourceMissing(t *testing.T) {
+	source := NewFileSource(promslog.NewNopLogger(), filepath.Join(t.TempDir(), "missing.yml"))
+	if _, err := source.Discover(context.Background()); err == nil {
+		t.Error("expected an error")
+	}
+	expectFileMetrics(t, source, "1", "0")
+}
+
+func TestManagerKeepsChannelsOfInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "channels.yml")
+	writeChannelsFile(t, path, `- targets: [dam0un]`)
+
+	m := NewManager(promslog.NewNopLogger(), 0)
+	m.Add("file", NewFileSource(promslog.NewNopLogger(), path))
+	m.Refresh(context.Background())
+
+	writeChannelsFile(t, path, `- targets: [dam0un`)
+	if m.Refresh(context.Background()) {
+		t.Error("expected an invalid file not to change the channels")
+	}
+	expectChannels(t, m.Channels(), Channel{Name: "dam0un"})
+}
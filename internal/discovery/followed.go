@@ -0,0 +1,90 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/nicklaw5/helix/v2"
+)
+
+// FollowedSource discovers the channels followed by the user owning the
+// token of the client, which has to be a user token with the
+// user:read:follows scope.
+type FollowedSource struct {
+	client HelixClient
+
+	mtx    sync.Mutex
+	userID string
+}
+
+// NewFollowedSource creates a source discovering the channels followed by the
+// owner of the client token.
+func NewFollowedSource(client HelixClient) *FollowedSource {
+	return &FollowedSource{client: client}
+}
+
+// Discover implements Source.
+func (s *FollowedSource) Discover(ctx context.Context) ([]Channel, error) {
+	userID, err := s.tokenOwner()
+	if err != nil {
+		return nil, err
+	}
+
+	var logins []string
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		resp, err := s.client.GetFollowedChannels(&helix.GetFollowedChannelParams{
+			UserID: userID,
+			First:  maxPerRequest,
+			After:  cursor,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != 200 {
+			return nil, errors.New(resp.ErrorMessage)
+		}
+
+		for _, channel := range resp.Data.FollowedChannels {
+			logins = append(logins, strings.ToLower(channel.BroadcaserLogin))
+		}
+
+		cursor = resp.Data.Pagination.Cursor
+		if cursor == "" || len(resp.Data.FollowedChannels) == 0 {
+			break
+		}
+	}
+
+	return channelsOf(logins), nil
+}
+
+// tokenOwner returns the ID of the user owning the client token, which is
+// only requested once.
+func (s *FollowedSource) tokenOwner() (string, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.userID != "" {
+		return s.userID, nil
+	}
+
+	resp, err := s.client.GetUsers(&helix.UsersParams{})
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != 200 {
+		return "", errors.New(resp.ErrorMessage)
+	}
+	if len(resp.Data.Users) == 0 {
+		return "", errors.New("token owner not found, a user access token is required")
+	}
+
+	s.userID = resp.Data.Users[0].ID
+	return s.userID, nil
+}
@@ -0,0 +1,52 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFollowedSourcePaginated(t *testing.T) {
+	s, client := newTestClient(t)
+	s.Respond("/channels/followed?user_id=1",
+		`{"data": [{"broadcaster_id": "2", "broadcaster_login": "surdaft"}], "pagination": {"cursor": "1"}}`,
+		`{"data": [{"broadcaster_id": "3", "broadcaster_login": "Other"}], "pagination": {}}`,
+	)
+
+	source := NewFollowedSource(client)
+	for range 2 {
+		channels, err := source.Discover(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectChannels(t, channels, Channel{Name: "surdaft"}, Channel{Name: "other"})
+	}
+
+	if n := s.Requests("/channels/followed"); n != 4 {
+		t.Errorf("expected 2 followed channels requests per discovery, got %d", n)
+	}
+	if n := s.Requests("/users"); n != 1 {
+		t.Errorf("expected the token owner to be requested once, got %d users requests", n)
+	}
+}
+
+func TestFollowedSourceAppToken(t *testing.T) {
+	s, client := newTestClient(t)
+	// app access tokens have no owner
+	s.Respond("/users", `{"data": []}`)
+
+	if _, err := NewFollowedSource(client).Discover(context.Background()); err == nil {
+		t.Error("expected an error without a user token")
+	}
+	if n := s.Requests("/channels/followed"); n != 0 {
+		t.Errorf("expected no followed channels request, got %d", n)
+	}
+}
+
+func TestFollowedSourceError(t *testing.T) {
+	s, client := newTestClient(t)
+	s.Error("/channels/followed", 401, "Missing scope: user:read:follows")
+
+	if _, err := NewFollowedSource(client).Discover(context.Background()); err == nil {
+		t.Error("expected an error")
+	}
+}
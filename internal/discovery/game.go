@@ -0,0 +1,122 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/nicklaw5/helix/v2"
+)
+
+// maxPerRequest is the maximum number of items requested from, or returned
+// by, a single call to the helix API.
+const maxPerRequest = 100
+
+// GameSource discovers the live channels with the most viewers in a set of
+// games or categories.
+type GameSource struct {
+	client HelixClient
+	logger *slog.Logger
+
+	gameIDs    []string
+	gameNames  []string
+	languages  []string
+	limit      int
+	minViewers int
+}
+
+// NewGameSource creates a source discovering at most limit live channels
+// streaming one of the given games, by ID or by name, in one of the given
+// languages if any, with at least minViewers viewers.
+func NewGameSource(client HelixClient, logger *slog.Logger, gameIDs, gameNames, languages []string, limit, minViewers int) *GameSource {
+	return &GameSource{
+		client:     client,
+		logger:     logger,
+		gameIDs:    gameIDs,
+		gameNames:  gameNames,
+		languages:  languages,
+		limit:      limit,
+		minViewers: minViewers,
+	}
+}
+
+// Discover implements Source.
+func (s *GameSource) Discover(ctx context.Context) ([]Channel, error) {
+	gameIDs, err := s.resolveGames()
+	if err != nil {
+		return nil, err
+	}
+
+	var logins []string
+	cursor := ""
+	for len(logins) < s.limit {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		resp, err := s.client.GetStreams(&helix.StreamsParams{
+			GameIDs:  gameIDs,
+			Language: s.languages,
+			Type:     "live",
+			First:    min(s.limit-len(logins), maxPerRequest),
+			After:    cursor,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != 200 {
+			return nil, errors.New(resp.ErrorMessage)
+		}
+
+		// streams are sorted by viewers, so the search stops at the first
+		// stream below the minimum
+		for _, stream := range resp.Data.Streams {
+			if stream.ViewerCount < s.minViewers {
+				return channelsOf(logins), nil
+			}
+			logins = append(logins, strings.ToLower(stream.UserLogin))
+		}
+
+		cursor = resp.Data.Pagination.Cursor
+		if cursor == "" || len(resp.Data.Streams) == 0 {
+			break
+		}
+	}
+
+	return channelsOf(logins[:min(len(logins), s.limit)]), nil
+}
+
+// resolveGames returns the IDs of the configured games, requesting the IDs of
+// the games configured by name.
+func (s *GameSource) resolveGames() ([]string, error) {
+	gameIDs := append([]string{}, s.gameIDs...)
+	if len(s.gameNames) == 0 {
+		return gameIDs, nil
+	}
+
+	resp, err := s.client.GetGames(&helix.GamesParams{Names: s.gameNames})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, errors.New(resp.ErrorMessage)
+	}
+
+	found := make(map[string]bool)
+	for _, game := range resp.Data.Games {
+		found[strings.ToLower(game.Name)] = true
+		gameIDs = append(gameIDs, game.ID)
+	}
+	for _, name := range s.gameNames {
+		if !found[strings.ToLower(name)] {
+			s.logger.Warn("game not found", "game", name)
+		}
+	}
+
+	if len(gameIDs) == 0 {
+		return nil, fmt.Errorf("none of the games %v was found", s.gameNames)
+	}
+	return gameIDs, nil
+}
@@ -0,0 +1,94 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/promslog"
+)
+
+// streamsPage returns a page of live streams of the given logins, each with
+// the given number of viewers, linking to the page of the cursor if any.
+func streamsPage(cursor string, streams map[string]int, logins ...string) string {
+	var data []string
+	for _, login := range logins {
+		data = append(data, fmt.Sprintf(`{"user_login": %q, "type": "live", "viewer_count": %d}`, login, streams[login]))
+	}
+	return fmt.Sprintf(`{"data": [%s], "pagination": {"cursor": %q}}`, strings.Join(data, ","), cursor)
+}
+
+func TestGameSourcePaginated(t *testing.T) {
+	s, client := newTestClient(t)
+	viewers := map[string]int{"a": 500, "b": 400, "c": 300, "d": 200, "e": 100}
+	s.Respond("/streams?game_id=509658",
+		streamsPage("1", viewers, "a", "b"),
+		streamsPage("2", viewers, "c", "d"),
+		streamsPage("", viewers, "e"),
+	)
+
+	source := NewGameSource(client, promslog.NewNopLogger(), []string{"509658"}, nil, nil, 3, 0)
+	channels, err := source.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectChannels(t, channels, Channel{Name: "a"}, Channel{Name: "b"}, Channel{Name: "c"})
+	if n := s.Requests("/streams"); n != 2 {
+		t.Errorf("expected the search to stop at the limit after 2 streams requests, got %d", n)
+	}
+}
+
+func TestGameSourceMinViewers(t *testing.T) {
+	s, client := newTestClient(t)
+	viewers := map[string]int{"a": 500, "b": 40, "c": 30}
+	s.Respond("/streams",
+		streamsPage("1", viewers, "a", "b"),
+		streamsPage("", viewers, "c"),
+	)
+
+	source := NewGameSource(client, promslog.NewNopLogger(), []string{"509658"}, nil, nil, 10, 100)
+	channels, err := source.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectChannels(t, channels, Channel{Name: "a"})
+	if n := s.Requests("/streams"); n != 1 {
+		t.Errorf("expected the search to stop below the minimum viewers, got %d streams requests", n)
+	}
+}
+
+func TestGameSourceByName(t *testing.T) {
+	s, client := newTestClient(t)
+	s.Respond("/streams?game_id=509658", streamsPage("", map[string]int{"Dam0un": 42}, "Dam0un"))
+
+	source := NewGameSource(client, promslog.NewNopLogger(), nil, []string{"just chatting", "missing"}, nil, 10, 0)
+	channels, err := source.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectChannels(t, channels, Channel{Name: "dam0un"})
+}
+
+func TestGameSourceGameNotFound(t *testing.T) {
+	s, client := newTestClient(t)
+	s.Respond("/games", `{"data": []}`)
+
+	source := NewGameSource(client, promslog.NewNopLogger(), nil, []string{"missing"}, nil, 10, 0)
+	if _, err := source.Discover(context.Background()); err == nil {
+		t.Error("expected an error for unknown games")
+	}
+	if n := s.Requests("/streams"); n != 0 {
+		t.Errorf("expected no streams request, got %d", n)
+	}
+}
+
+func TestGameSourceError(t *testing.T) {
+	s, client := newTestClient(t)
+	s.Error("/streams", 500, "Internal Server Error")
+
+	source := NewGameSource(client, promslog.NewNopLogger(), []string{"509658"}, nil, nil, 10, 0)
+	if _, err := source.Discover(context.Background()); err == nil {
+		t.Error("expected an error")
+	}
+}
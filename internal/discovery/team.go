@@ -0,0 +1,173 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/nicklaw5/helix/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var teamInfoDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "channel", "team_info"),
+	"Membership of a channel in a Twitch team, the value is always 1.",
+	[]string{"username", "team"}, nil,
+)
+
+// TeamsClient requests the Twitch teams endpoint, which is not supported by
+// the helix client.
+type TeamsClient struct {
+	httpClient helix.HTTPClient
+	baseURL    string
+	clientID   string
+	// token returns the access token sent with every request, it is read on
+	// every request as tokens are refreshed in the background.
+	token func() string
+}
+
+// NewTeamsClient creates a client for the teams endpoint of the helix API at
+// baseURL, e.g. helix.DefaultAPIBaseURL.
+func NewTeamsClient(httpClient helix.HTTPClient, baseURL, clientID string, token func() string) *TeamsClient {
+	return &TeamsClient{
+		httpClient: httpClient,
+		baseURL:    baseURL,
+		clientID:   clientID,
+		token:      token,
+	}
+}
+
+type teamsResponse struct {
+	Data []struct {
+		TeamName string `json:"team_name"`
+		Users    []struct {
+			UserID    string `json:"user_id"`
+			UserLogin string `json:"user_login"`
+			UserName  string `json:"user_name"`
+		} `json:"users"`
+	} `json:"data"`
+	Message string `json:"message"`
+}
+
+// teamMember is a member of a team.
+type teamMember struct {
+	login       string
+	displayName string
+}
+
+// members returns the members of the team with the given name.
+func (c *TeamsClient) members(ctx context.Context, team string) ([]teamMember, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/teams?"+url.Values{"name": {team}}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Client-Id", c.clientID)
+	req.Header.Set("Authorization", "Bearer "+c.token())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body teamsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding team %s: %w", team, err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("team %s: %s", team, body.Message)
+	}
+	if len(body.Data) == 0 {
+		return nil, fmt.Errorf("team %s not found", team)
+	}
+
+	var members []teamMember
+	for _, user := range body.Data[0].Users {
+		members = append(members, teamMember{login: strings.ToLower(user.UserLogin), displayName: user.UserName})
+	}
+	return members, nil
+}
+
+// TeamSource discovers the members of Twitch teams. It implements
+// prometheus.Collector, exposing the team of every member.
+type TeamSource struct {
+	client *TeamsClient
+	logger *slog.Logger
+	teams  []string
+	// displayNames labels the members with their display name rather than
+	// their login, matching the username label of the channel metrics.
+	displayNames bool
+
+	mtx     sync.Mutex
+	members map[string][]teamMember
+}
+
+// NewTeamSource creates a source discovering the members of the given teams,
+// labelled with their display name if displayNames is set.
+func NewTeamSource(client *TeamsClient, logger *slog.Logger, teams []string, displayNames bool) *TeamSource {
+	return &TeamSource{
+		client:       client,
+		logger:       logger,
+		teams:        teams,
+		displayNames: displayNames,
+		members:      make(map[string][]teamMember),
+	}
+}
+
+// Discover implements Source. A team failing to resolve keeps its previous
+// members, the others are still refreshed.
+func (s *TeamSource) Discover(ctx context.Context) ([]Channel, error) {
+	var errs []error
+	for _, team := range s.teams {
+		members, err := s.client.members(ctx, team)
+		if err != nil {
+			s.logger.Error("Error requesting team members", "team", team, "err", err)
+			errs = append(errs, err)
+			continue
+		}
+
+		s.mtx.Lock()
+		s.members[team] = members
+		s.mtx.Unlock()
+	}
+	if len(errs) == len(s.teams) {
+		return nil, fmt.Errorf("no team could be resolved: %w", errs[0])
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var logins []string
+	for _, members := range s.members {
+		for _, member := range members {
+			logins = append(logins, member.login)
+		}
+	}
+	return channelsOf(logins), nil
+}
+
+// Describe implements prometheus.Collector.
+func (s *TeamSource) Describe(ch chan<- *prometheus.Desc) {
+	ch <- teamInfoDesc
+}
+
+// Collect implements prometheus.Collector.
+func (s *TeamSource) Collect(ch chan<- prometheus.Metric) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for team, members := range s.members {
+		for _, member := range members {
+			username := member.login
+			if s.displayNames {
+				username = member.displayName
+			}
+			ch <- prometheus.MustNewConstMetric(teamInfoDesc, prometheus.GaugeValue, 1, username, team)
+		}
+	}
+}
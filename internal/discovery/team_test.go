@@ -0,0 +1,102 @@
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/damoun/twitch_exporter/internal/helixtest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promslog"
+)
+
+func newTestTeamSource(t *testing.T, displayNames bool, teams ...string) (*helixtest.Server, *TeamSource) {
+	t.Helper()
+
+	s, _ := newTestClient(t)
+	client := NewTeamsClient(http.DefaultClient, s.URL, helixtest.ClientID, func() string {
+		return helixtest.AccessToken
+	})
+	return s, NewTeamSource(client, promslog.NewNopLogger(), teams, displayNames)
+}
+
+func TestTeamSource(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		displayNames bool
+		username     string
+	}{
+		{name: "login", username: "dam0un"},
+		{name: "display name", displayNames: true, username: "Dam0un"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, source := newTestTeamSource(t, tc.displayNames, "exporters")
+
+			channels, err := source.Discover(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectChannels(t, channels, Channel{Name: "dam0un"})
+
+			expected := `
+# HELP twitch_channel_team_info Membership of a channel in a Twitch team, the value is always 1.
+# TYPE twitch_channel_team_info gauge
+twitch_channel_team_info{team="exporters",username="` + tc.username + `"} 1
+`
+			if err := testutil.CollectAndCompare(source, strings.NewReader(expected)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestTeamSourceErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		respond func(s *helixtest.Server)
+	}{
+		{
+			name:    "error response",
+			respond: func(s *helixtest.Server) { s.Error("/teams", 500, "Internal Server Error") },
+		},
+		{
+			name:    "team not found",
+			respond: func(s *helixtest.Server) { s.Respond("/teams", `{"data": []}`) },
+		},
+		{
+			name:    "invalid response",
+			respond: func(s *helixtest.Server) { s.Respond("/teams", `not json`) },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, source := newTestTeamSource(t, false, "exporters")
+			tc.respond(s)
+
+			if _, err := source.Discover(context.Background()); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestTeamSourceKeepsMembersOfFailingTeam(t *testing.T) {
+	s, source := newTestTeamSource(t, false, "exporters", "friends")
+	s.Respond("/teams?name=friends", `{"data": [{
+		"team_name": "friends",
+		"users": [{"user_id": "2", "user_login": "surdaft", "user_name": "surdaft"}]
+	}]}`)
+
+	if _, err := source.Discover(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Error("/teams?name=friends", 500, "Internal Server Error")
+	channels, err := source.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(channels) != 2 {
+		t.Errorf("expected the members of both teams, got %+v", channels)
+	}
+}
@@ -0,0 +1,184 @@
+// Package helixmetrics instruments the HTTP client used by the helix client,
+// exposing metrics about every request sent to the Twitch API and tracking the
+// rate limit budget of each token.
+package helixmetrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nicklaw5/helix/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace = "twitch"
+	subsystem = "helix"
+)
+
+// Metrics holds the metrics shared by every instrumented client. It
+// implements prometheus.Collector.
+type Metrics struct {
+	requests  *prometheus.CounterVec
+	errors    *prometheus.CounterVec
+	duration  *prometheus.HistogramVec
+	limit     *prometheus.GaugeVec
+	remaining *prometheus.GaugeVec
+	reset     *prometheus.GaugeVec
+
+	mtx     sync.Mutex
+	clients map[string]*Client
+}
+
+func New() *Metrics {
+	return &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "requests_total",
+			Help:      "Number of requests sent to the Twitch API.",
+		}, []string{"client", "endpoint", "code"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "request_errors_total",
+			Help:      "Number of failed requests to the Twitch API, code is empty when no response was received.",
+		}, []string{"client", "endpoint", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "request_duration_seconds",
+			Help:      "Duration of the requests sent to the Twitch API.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"client", "endpoint"}),
+		limit: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "ratelimit_limit",
+			Help:      "Rate limit bucket size of the client token, as reported by the last response.",
+		}, []string{"client"}),
+		remaining: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "ratelimit_remaining",
+			Help:      "Remaining rate limit points of the client token, as reported by the last response.",
+		}, []string{"client"}),
+		reset: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "ratelimit_reset_timestamp_seconds",
+			Help:      "Unix timestamp at which the rate limit bucket of the client token is refilled.",
+		}, []string{"client"}),
+		clients: make(map[string]*Client),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.errors.Describe(ch)
+	m.duration.Describe(ch)
+	m.limit.Describe(ch)
+	m.remaining.Describe(ch)
+	m.reset.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.errors.Collect(ch)
+	m.duration.Collect(ch)
+	m.limit.Collect(ch)
+	m.remaining.Collect(ch)
+	m.reset.Collect(ch)
+}
+
+// Client returns the instrumented client with the given name, which is used
+// as the client label. Clients sharing a token, and therefore a rate limit
+// bucket, should share a name.
+func (m *Metrics) Client(name string) *Client {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if c, ok := m.clients[name]; ok {
+		return c
+	}
+
+	c := &Client{
+		name:       name,
+		metrics:    m,
+		httpClient: http.DefaultClient,
+	}
+	m.clients[name] = c
+	return c
+}
+
+// Client is an instrumented helix.HTTPClient.
+type Client struct {
+	name       string
+	metrics    *Metrics
+	httpClient helix.HTTPClient
+
+	mtx       sync.Mutex
+	known     bool
+	remaining int
+	reset     time.Time
+}
+
+// Do implements helix.HTTPClient.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	endpoint := req.URL.Path
+
+	begin := time.Now()
+	resp, err := c.httpClient.Do(req)
+	c.metrics.duration.WithLabelValues(c.name, endpoint).Observe(time.Since(begin).Seconds())
+
+	if err != nil {
+		c.metrics.errors.WithLabelValues(c.name, endpoint, "").Inc()
+		return resp, err
+	}
+
+	code := strconv.Itoa(resp.StatusCode)
+	c.metrics.requests.WithLabelValues(c.name, endpoint, code).Inc()
+	if resp.StatusCode >= http.StatusBadRequest {
+		c.metrics.errors.WithLabelValues(c.name, endpoint, code).Inc()
+	}
+
+	c.observeRateLimit(resp.Header)
+
+	return resp, nil
+}
+
+// observeRateLimit records the rate limit headers of a response, which are
+// only sent by the helix API and not by the authentication endpoints.
+func (c *Client) observeRateLimit(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("Ratelimit-Remaining"))
+	if err != nil {
+		return
+	}
+	limit, _ := strconv.Atoi(header.Get("Ratelimit-Limit"))
+	resetUnix, _ := strconv.ParseInt(header.Get("Ratelimit-Reset"), 10, 64)
+	reset := time.Unix(resetUnix, 0)
+
+	c.mtx.Lock()
+	c.known = true
+	c.remaining = remaining
+	c.reset = reset
+	c.mtx.Unlock()
+
+	c.metrics.limit.WithLabelValues(c.name).Set(float64(limit))
+	c.metrics.remaining.WithLabelValues(c.name).Set(float64(remaining))
+	c.metrics.reset.WithLabelValues(c.name).Set(float64(resetUnix))
+}
+
+// RateLimitRemaining returns the remaining rate limit points of the client
+// token and when they are refilled, as reported by the last response. ok is
+// false until a response with rate limit headers has been received.
+func (c *Client) RateLimitRemaining() (remaining int, reset time.Time, ok bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.remaining, c.reset, c.known
+}
@@ -0,0 +1,88 @@
+package helixtest
+
+// fixtures are the default responses of the server, describing a single live
+// channel, dam0un, with the ID 1, which owns the user token.
+var fixtures = map[string]string{
+	"/oauth2/validate": `{
+		"client_id": "helixtest-client-id", "login": "dam0un", "user_id": "1",
+		"scopes": ["channel:read:subscriptions", "bits:read"], "expires_in": 14400
+	}`,
+
+	"/users": `{"data": [{
+		"id": "1", "login": "dam0un", "display_name": "Dam0un",
+		"type": "", "broadcaster_type": "affiliate",
+		"created_at": "2016-12-14T20:32:28Z"
+	}]}`,
+
+	"/streams": `{"data": [{
+		"id": "40952121085", "user_id": "1", "user_login": "dam0un", "user_name": "Dam0un",
+		"game_id": "509658", "game_name": "Just Chatting", "type": "live",
+		"title": "Building exporters", "viewer_count": 42,
+		"started_at": "2021-03-10T15:04:21Z", "language": "en"
+	}], "pagination": {}}`,
+
+	"/channels": `{"data": [{
+		"broadcaster_id": "1", "broadcaster_login": "dam0un", "broadcaster_name": "Dam0un",
+		"broadcaster_language": "en", "game_id": "509658", "game_name": "Just Chatting",
+		"title": "Building exporters", "delay": 0
+	}]}`,
+
+	"/channels/followers": `{"data": [], "total": 1337, "pagination": {}}`,
+
+	"/channels/followed": `{"data": [
+		{"broadcaster_id": "2", "broadcaster_login": "surdaft", "broadcaster_name": "surdaft", "followed_at": "2022-05-24T22:22:08Z"}
+	], "total": 1, "pagination": {}}`,
+
+	"/chat/emotes": `{"data": [
+		{"id": "304456832", "name": "dam0unHi", "tier": "1000", "emote_type": "subscriptions"},
+		{"id": "304456833", "name": "dam0unBye", "tier": "1000", "emote_type": "subscriptions"}
+	]}`,
+
+	"/clips": `{"data": [
+		{"id": "AwkwardHelplessSalamanderSwiftRage", "broadcaster_id": "1", "broadcaster_name": "Dam0un"},
+		{"id": "HelplessAwkwardSwiftRageSalamander", "broadcaster_id": "1", "broadcaster_name": "Dam0un"}
+	], "pagination": {}}`,
+
+	"/chat/settings": `{"data": [{
+		"broadcaster_id": "1", "emote_mode": false, "follower_mode": true,
+		"follower_mode_duration": 10, "slow_mode": true, "slow_mode_wait_time": 30,
+		"subscriber_mode": false, "unique_chat_mode": false
+	}]}`,
+
+	"/chat/chatters": `{"data": [{"user_id": "2", "user_login": "surdaft", "user_name": "surdaft"}], "pagination": {}, "total": 8}`,
+
+	"/moderation/moderators": `{"data": [{"user_id": "2", "user_login": "surdaft", "user_name": "surdaft"}], "pagination": {}}`,
+
+	"/channels/vips": `{"data": [{"user_id": "2", "user_login": "surdaft", "user_name": "surdaft"}], "pagination": {}}`,
+
+	"/moderation/banned": `{"data": [{"user_id": "3", "user_login": "spammer", "user_name": "spammer"}], "pagination": {}}`,
+
+	"/subscriptions": `{"data": [
+		{"broadcaster_id": "1", "is_gift": false, "tier": "1000", "user_id": "2"},
+		{"broadcaster_id": "1", "is_gift": true, "tier": "1000", "user_id": "3"},
+		{"broadcaster_id": "1", "is_gift": false, "tier": "3000", "user_id": "4"}
+	], "pagination": {}, "total": 3, "points": 8}`,
+
+	"/bits/leaderboard": `{"data": [
+		{"user_id": "2", "user_login": "surdaft", "user_name": "surdaft", "rank": 1, "score": 500},
+		{"user_id": "3", "user_login": "spammer", "user_name": "spammer", "rank": 2, "score": 100}
+	], "total": 2}`,
+
+	"/goals": `{"data": [{
+		"id": "1woowvbkiNv8BRxEWSqmQz6Zk92", "broadcaster_id": "1", "type": "follower",
+		"description": "Follow goal", "current_amount": 1337, "target_amount": 1500
+	}]}`,
+
+	"/charity/campaigns": `{"data": [{
+		"id": "123-abc-456-def", "broadcaster_id": "1", "charity_name": "Example",
+		"current_amount": {"value": 86000, "decimal_places": 2, "currency": "USD"},
+		"target_amount": {"value": 1500000, "decimal_places": 2, "currency": "USD"}
+	}]}`,
+
+	"/games": `{"data": [{"id": "509658", "name": "Just Chatting", "box_art_url": ""}]}`,
+
+	"/teams": `{"data": [{
+		"id": "6358", "team_name": "exporters", "team_display_name": "Exporters",
+		"users": [{"user_id": "1", "user_login": "dam0un", "user_name": "Dam0un"}]
+	}]}`,
+}
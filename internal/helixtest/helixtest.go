@@ -0,0 +1,219 @@
+// Package helixtest provides an in-process fake of the Twitch helix API. It
+// serves canned JSON responses for every endpoint used by the collectors, so
+// that they can be exercised offline, including paginated and error responses.
+package helixtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/nicklaw5/helix/v2"
+)
+
+const (
+	// ClientID is the client ID expected by the server.
+	ClientID = "helixtest-client-id"
+	// AccessToken is the access token of the clients returned by NewClient.
+	AccessToken = "helixtest-access-token"
+)
+
+// route is a set of canned responses for a path, optionally restricted to
+// requests matching some query parameters.
+type route struct {
+	query  url.Values
+	status int
+	pages  []string
+}
+
+// Server is a fake helix API server.
+type Server struct {
+	*httptest.Server
+
+	mtx      sync.Mutex
+	routes   map[string][]route
+	requests map[string]int
+}
+
+// NewServer starts a fake helix API server serving the default fixtures. It
+// has to be closed once done.
+func NewServer() *Server {
+	s := &Server{
+		routes:   make(map[string][]route),
+		requests: make(map[string]int),
+	}
+	for path, body := range fixtures {
+		s.Respond(path, body)
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// NewClient returns a helix client sending its requests to the server, using
+// an app access token.
+func (s *Server) NewClient() (*helix.Client, error) {
+	return helix.NewClient(&helix.Options{
+		ClientID:       ClientID,
+		AppAccessToken: AccessToken,
+		APIBaseURL:     s.URL,
+	})
+}
+
+// HTTPClient returns an HTTP client sending the requests of the helix
+// authentication endpoints, e.g. the token validation, to the server rather
+// than to helix.AuthBaseURL. They are served under the path of the endpoint,
+// e.g. "/oauth2/validate".
+func (s *Server) HTTPClient() helix.HTTPClient {
+	return &http.Client{Transport: authTransport{server: s}}
+}
+
+// authTransport rewrites the requests of the authentication endpoints to the
+// server.
+type authTransport struct {
+	server *Server
+}
+
+func (t authTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	target, err := url.Parse(t.server.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host, r.Host = target.Scheme, target.Host, target.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// Respond replaces the responses to target, a path optionally followed by
+// query parameters, e.g. "/clips?broadcaster_id=1". A request is answered by
+// the route of its path whose query parameters all match the request and
+// which has the most query parameters.
+//
+// Every page is a full JSON response body. The first page is served to
+// requests without an after cursor, the page n to requests with an after
+// cursor of n, so pages link to each other with a pagination cursor of "1",
+// "2", and so on.
+func (s *Server) Respond(target string, pages ...string) {
+	s.respond(target, http.StatusOK, pages)
+}
+
+// Error makes the server answer target with a helix error response.
+func (s *Server) Error(target string, status int, message string) {
+	body, _ := json.Marshal(map[string]any{
+		"error":   http.StatusText(status),
+		"status":  status,
+		"message": message,
+	})
+	s.respond(target, status, []string{string(body)})
+}
+
+func (s *Server) respond(target string, status int, pages []string) {
+	u, err := url.Parse(target)
+	if err != nil {
+		panic(fmt.Sprintf("helixtest: invalid target %q: %v", target, err))
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	query := u.Query()
+	routes := s.routes[u.Path][:0:0]
+	for _, r := range s.routes[u.Path] {
+		if r.query.Encode() != query.Encode() {
+			routes = append(routes, r)
+		}
+	}
+	s.routes[u.Path] = append(routes, route{query: query, status: status, pages: pages})
+}
+
+// Requests returns the number of requests received for path.
+func (s *Server) Requests(path string) int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.requests[path]
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	s.requests[r.URL.Path]++
+	route, ok := s.match(r)
+	s.mtx.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Ratelimit-Limit", "800")
+	w.Header().Set("Ratelimit-Remaining", "799")
+
+	if r.Header.Get("Client-Id") != ClientID {
+		writeError(w, http.StatusUnauthorized, "invalid client id")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "no fixture for "+r.URL.Path)
+		return
+	}
+
+	page := 0
+	if after := r.URL.Query().Get("after"); after != "" {
+		var err error
+		page, err = strconv.Atoi(after)
+		if err != nil || page < 0 || page >= len(route.pages) {
+			writeError(w, http.StatusBadRequest, "invalid cursor "+after)
+			return
+		}
+	}
+
+	w.WriteHeader(route.status)
+	_, _ = w.Write([]byte(route.pages[page]))
+}
+
+// match returns the most specific route matching the request, s.mtx must be
+// held.
+func (s *Server) match(r *http.Request) (route, bool) {
+	query := r.URL.Query()
+
+	var (
+		best  route
+		found bool
+	)
+	for _, candidate := range s.routes[r.URL.Path] {
+		if !matches(candidate.query, query) {
+			continue
+		}
+		if !found || len(candidate.query) > len(best.query) {
+			best = candidate
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+func matches(expected, query url.Values) bool {
+	for key, values := range expected {
+		got := query[key]
+		if len(got) != len(values) {
+			return false
+		}
+		for i := range values {
+			if got[i] != values[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error":   http.StatusText(status),
+		"status":  status,
+		"message": message,
+	})
+}
@@ -0,0 +1,230 @@
+// Copyright 2020 Damien PLÉNARD.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/damoun/twitch_exporter/collector"
+	"github.com/nicklaw5/helix/v2"
+)
+
+// oauthStateTTL is how long a login started on /oauth/login can be completed.
+const oauthStateTTL = 10 * time.Minute
+
+var oauthRedirectURL = kingpin.Flag("twitch.oauth-redirect-url",
+	"Public URL of the /oauth/callback endpoint, registered as OAuth redirect URL of the Twitch application. When set, user tokens can be obtained by browsing /oauth/login.").
+	Default("").String()
+
+// requiredScopes returns the scopes of the user token required by the
+// collectors run with cfg and by the channel discovery.
+func requiredScopes(cfg collector.Config) []string {
+	scopes := collector.RequiredScopes(cfg)
+	if *followedChannels {
+		scopes = append(scopes, "user:read:follows")
+		slices.Sort(scopes)
+	}
+	return scopes
+}
+
+// tokenTarget is a client receiving the user tokens obtained through OAuth,
+// along with the files they are persisted to.
+type tokenTarget struct {
+	client *helix.Client
+	token  userToken
+}
+
+// oauthHandler runs the OAuth authorization code flow, handing the user
+// tokens to the client of the broadcaster who authorized the exporter, or to
+// the default client. Only the tokens of the configured broadcasters, and of
+// the owner of the default user token, are accepted, so that anyone reaching
+// the endpoints can't replace a token with their own.
+type oauthHandler struct {
+	logger *slog.Logger
+	// client exchanges the authorization codes, it is configured with the
+	// redirect URL.
+	client   *helix.Client
+	exporter *collector.Exporter
+	// tokens knows the owner of the default user token, and validates the
+	// tokens obtained.
+	tokens *tokenValidator
+	// reapply applies the configuration again once a token was obtained, so
+	// that the collectors are checked against its scopes.
+	reapply func()
+
+	defaultTarget tokenTarget
+	// broadcasters are keyed by lowercase login, or by "id:" and user ID.
+	broadcasters map[string]tokenTarget
+
+	mtx    sync.Mutex
+	states map[string]time.Time
+}
+
+func newOAuthHandler(logger *slog.Logger, httpClient helix.HTTPClient, exporter *collector.Exporter, tokens *tokenValidator, reapply func(), defaultTarget tokenTarget, broadcasters map[string]tokenTarget) (*oauthHandler, error) {
+	client, err := helix.NewClient(&helix.Options{
+		ClientID:     *twitchClientID,
+		ClientSecret: *twitchClientSecret,
+		RedirectURI:  *oauthRedirectURL,
+		HTTPClient:   httpClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauthHandler{
+		logger:        logger,
+		client:        client,
+		exporter:      exporter,
+		tokens:        tokens,
+		reapply:       reapply,
+		defaultTarget: defaultTarget,
+		broadcasters:  broadcasters,
+		states:        make(map[string]time.Time),
+	}, nil
+}
+
+// login redirects to the Twitch authorization page, requesting the scopes of
+// the enabled collectors.
+func (h *oauthHandler) login(w http.ResponseWriter, r *http.Request) {
+	state, err := h.newState()
+	if err != nil {
+		http.Error(w, "Failed to start login: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	scopes := requiredScopes(h.exporter.Config())
+	h.logger.Info("starting OAuth login", "scopes", scopes)
+
+	http.Redirect(w, r, h.client.GetAuthorizationURL(&helix.AuthorizationURLParams{
+		ResponseType: "code",
+		Scopes:       scopes,
+		State:        state,
+		ForceVerify:  true,
+	}), http.StatusFound)
+}
+
+// callback exchanges the authorization code for user tokens and hands them to
+// the client of the token owner.
+func (h *oauthHandler) callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if !h.checkState(query.Get("state")) {
+		http.Error(w, "Invalid or expired state, start again from /oauth/login", http.StatusBadRequest)
+		return
+	}
+	if e := query.Get("error"); e != "" {
+		h.logger.Error("OAuth login denied", "err", e, "description", query.Get("error_description"))
+		http.Error(w, "Authorization denied: "+query.Get("error_description"), http.StatusForbidden)
+		return
+	}
+
+	login, scopes, err := h.authorize(query.Get("code"))
+	if err != nil {
+		h.logger.Error("Error completing the OAuth login", "err", err)
+		http.Error(w, "Failed to obtain tokens: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	fmt.Fprintf(w, "Authorized %s with scopes: %s\n", login, strings.Join(scopes, " "))
+}
+
+// authorize exchanges the code for user tokens and applies them, it returns
+// the login of the token owner and the granted scopes.
+func (h *oauthHandler) authorize(code string) (string, []string, error) {
+	if code == "" {
+		return "", nil, errors.New("missing authorization code")
+	}
+
+	resp, err := h.client.RequestUserAccessToken(code)
+	if err != nil {
+		return "", nil, err
+	}
+	if resp.ErrorStatus != 0 {
+		return "", nil, errors.New(resp.ErrorMessage)
+	}
+	accessToken, refreshToken := resp.Data.AccessToken, resp.Data.RefreshToken
+
+	valid, validation, err := h.client.ValidateToken(accessToken)
+	if err != nil {
+		return "", nil, err
+	}
+	if !valid {
+		return "", nil, fmt.Errorf("token validation failed: %s", validation.ErrorMessage)
+	}
+	login := strings.ToLower(validation.Data.Login)
+
+	target, ok := h.broadcasters[login]
+	if !ok {
+		target, ok = h.broadcasters["id:"+validation.Data.UserID]
+	}
+	if !ok {
+		if !h.ownsDefaultToken(validation.Data.UserID) {
+			return "", nil, fmt.Errorf("%s is neither a configured broadcaster nor the owner of the default token", login)
+		}
+		target = h.defaultTarget
+	}
+	target.client.SetUserAccessToken(accessToken)
+	target.client.SetRefreshToken(refreshToken)
+	h.logger.Info("user token obtained through OAuth", "login", login, "broadcaster_client", ok, "scopes", resp.Data.Scopes)
+
+	// the token metrics and the collectors skipped for lack of scopes are
+	// updated right away rather than at the next validation
+	h.tokens.ValidateClient(target.client)
+	h.reapply()
+
+	if err := target.token.persist(accessToken, refreshToken); err != nil {
+		return "", nil, fmt.Errorf("persisting tokens: %w", err)
+	}
+
+	return login, resp.Data.Scopes, nil
+}
+
+// ownsDefaultToken returns whether the user owns the default user token, as
+// of its last successful validation. Without a default user token, there is
+// no owner.
+func (h *oauthHandler) ownsDefaultToken(userID string) bool {
+	token, ok := h.tokens.token("user")
+	return ok && token.ownerID != "" && token.ownerID == userID
+}
+
+func (h *oauthHandler) newState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	state := hex.EncodeToString(b)
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	now := time.Now()
+	for s, expires := range h.states {
+		if now.After(expires) {
+			delete(h.states, s)
+		}
+	}
+	h.states[state] = now.Add(oauthStateTTL)
+
+	return state, nil
+}
+
+// checkState returns whether the state was issued by login and has not
+// expired, a state can only be used once.
+func (h *oauthHandler) checkState(state string) bool {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	expires, ok := h.states[state]
+	delete(h.states, state)
+	return ok && time.Now().Before(expires)
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 Damien PLÉNARD.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/damoun/twitch_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// probeHandler exposes the metrics of the single channel given by the target
+// parameter, in the style of the blackbox_exporter. Only the collectors given
+// by the collector parameters are used, or every enabled collector if there
+// are none.
+func probeHandler(w http.ResponseWriter, r *http.Request, logger *slog.Logger, exporter *collector.Exporter) {
+	params := r.URL.Query()
+
+	target := params.Get("target")
+	if target == "" {
+		http.Error(w, "Target parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	logger = logger.With("target", target)
+
+	probeExporter, err := exporter.ForChannels(logger, collector.ChannelNames{target}, params["collector"]...)
+	if err != nil {
+		logger.Error("Error creating the probe exporter", "err", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := scrapeContext(r)
+	defer cancel()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(probeExporter.WithContext(ctx))
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		ErrorLog:      promHTTPLogger{logger: logger},
+		ErrorHandling: promhttp.ContinueOnError,
+	}).ServeHTTP(w, r)
+}
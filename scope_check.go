@@ -0,0 +1,190 @@
+// Copyright 2020 Damien PLÉNARD.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/damoun/twitch_exporter/collector"
+)
+
+var scopeCheck = kingpin.Flag("twitch.scope-check",
+	"What to do when the token used for a channel lacks the user token or the scopes required by a collector: warn, skip the collector for that channel, or fail.").
+	Default("warn").Enum("warn", "skip", "fail")
+
+// missingToken is a collector whose token lacks its requirements for some
+// channels.
+type missingToken struct {
+	collector string
+	// token is the type of the token, as exposed by the token metrics.
+	token    string
+	channels []string
+	// notUser is true when the token is not a user access token, scopes are
+	// then the ones it would need.
+	notUser bool
+	scopes  []string
+}
+
+func (m missingToken) String() string {
+	if m.notUser {
+		return fmt.Sprintf("%s requires a user token with scopes [%s], the %s token is not one (channels: %s)",
+			m.collector, strings.Join(m.scopes, " "), m.token, strings.Join(m.channels, ", "))
+	}
+	return fmt.Sprintf("%s requires the scopes [%s] missing from the %s token (channels: %s)",
+		m.collector, strings.Join(m.scopes, " "), m.token, strings.Join(m.channels, ", "))
+}
+
+// scopeChecker compares the tokens required by the collectors with the
+// validated tokens of the channels they run for, and warns about, skips or
+// rejects the collectors whose token lacks their requirements.
+type scopeChecker struct {
+	logger *slog.Logger
+	tokens *tokenValidator
+	mode   string
+	// defaultToken is the type of the token of the channels without a
+	// broadcaster token.
+	defaultToken string
+	// router routes the requests of the channels to the broadcaster tokens,
+	// nil without any.
+	router *collector.ClientRouter
+}
+
+func newScopeChecker(logger *slog.Logger, tokens *tokenValidator, defaultToken string, router *collector.ClientRouter) *scopeChecker {
+	return &scopeChecker{
+		logger:       logger,
+		tokens:       tokens,
+		mode:         *scopeCheck,
+		defaultToken: defaultToken,
+		router:       router,
+	}
+}
+
+// tokenFor returns the type of the token the requests of the channel are
+// sent with, as routed by the client router.
+func (c *scopeChecker) tokenFor(channel collector.Channel) string {
+	if c.router == nil {
+		return c.defaultToken
+	}
+	if broadcaster, ok := c.router.Broadcaster(channel.Name); ok {
+		return "user:" + broadcaster
+	}
+	return c.defaultToken
+}
+
+// missing returns the collectors run with cfg whose token lacks their
+// requirements. Tokens which could not be validated, or are invalid, are not
+// checked: there is nothing to compare with.
+func (c *scopeChecker) missing(cfg collector.Config) []missingToken {
+	var missing []missingToken
+	for _, required := range collector.RequiredTokens(cfg) {
+		if !required.User {
+			continue
+		}
+
+		byToken := make(map[string]*missingToken)
+		for _, channel := range required.Channels {
+			typ := c.tokenFor(channel)
+			token, ok := c.tokens.token(typ)
+			if !ok || !token.validated || !token.valid {
+				continue
+			}
+
+			m := missingToken{collector: required.Collector, token: typ, notUser: !token.user, scopes: required.Scopes}
+			if token.user {
+				m.scopes = nil
+				for _, scope := range required.Scopes {
+					if !slices.Contains(token.scopes, scope) {
+						m.scopes = append(m.scopes, scope)
+					}
+				}
+				if len(m.scopes) == 0 {
+					continue
+				}
+			}
+
+			if byToken[typ] == nil {
+				byToken[typ] = &m
+			}
+			byToken[typ].channels = append(byToken[typ].channels, channel.Name)
+		}
+
+		for _, typ := range slices.Sorted(maps.Keys(byToken)) {
+			missing = append(missing, *byToken[typ])
+		}
+	}
+	return missing
+}
+
+// check reports the collectors whose token lacks their requirements and
+// returns cfg, without these collectors for the affected channels in skip
+// mode. It fails in fail mode.
+func (c *scopeChecker) check(cfg collector.Config) (collector.Config, error) {
+	missing := c.missing(cfg)
+	if len(missing) == 0 {
+		return cfg, nil
+	}
+
+	level := slog.LevelWarn
+	if c.mode == "fail" {
+		level = slog.LevelError
+	}
+	for _, m := range missing {
+		c.logger.Log(context.Background(), level, "collector token lacks requirements", "collector", m.collector, "token", m.token,
+			"not_user_token", m.notUser, "missing_scopes", m.scopes, "channels", m.channels, "action", c.mode)
+	}
+
+	switch c.mode {
+	case "fail":
+		report := make([]string, 0, len(missing))
+		for _, m := range missing {
+			report = append(report, m.String())
+		}
+		return cfg, fmt.Errorf("tokens lack the requirements of the collectors: %s", strings.Join(report, "; "))
+	case "skip":
+		return c.skip(cfg, missing), nil
+	}
+	return cfg, nil
+}
+
+// skip returns cfg with every channel of missing excluding the collector, the
+// collectors left without any channel are disabled.
+func (c *scopeChecker) skip(cfg collector.Config, missing []missingToken) collector.Config {
+	excluded := make(map[string][]string)
+	for _, m := range missing {
+		for _, channel := range m.channels {
+			excluded[channel] = append(excluded[channel], m.collector)
+		}
+	}
+
+	channels := make(collector.Channels, 0, len(cfg.Channels))
+	for _, channel := range cfg.Channels {
+		if collectors, ok := excluded[channel.Name]; ok {
+			channel.ExcludeCollectors = append(slices.Clone(channel.ExcludeCollectors), collectors...)
+		}
+		channels = append(channels, channel)
+	}
+	cfg.Channels = channels
+
+	collectors := maps.Clone(cfg.Collectors)
+	if collectors == nil {
+		collectors = make(map[string]collector.CollectorConfig)
+	}
+	for _, required := range collector.RequiredTokens(cfg) {
+		if len(required.Channels) == 0 {
+			disabled := false
+			cc := collectors[required.Collector]
+			cc.Enabled = &disabled
+			collectors[required.Collector] = cc
+		}
+	}
+	cfg.Collectors = collectors
+
+	return cfg
+}
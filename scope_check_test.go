@@ -0,0 +1,154 @@
+// Copyright 2020 Damien PLÉNARD.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/damoun/twitch_exporter/collector"
+	"github.com/damoun/twitch_exporter/internal/helixtest"
+	"github.com/prometheus/common/promslog"
+)
+
+// newTestScopeChecker returns a checker of the given validated tokens, the
+// requests of every channel being sent with the default user token unless a
+// router is given.
+func newTestScopeChecker(mode string, router *collector.ClientRouter, tokens ...*validatedToken) *scopeChecker {
+	logger := promslog.NewNopLogger()
+	c := newScopeChecker(logger, &tokenValidator{logger: logger, tokens: tokens}, "user", router)
+	c.mode = mode
+	return c
+}
+
+// validUserToken returns a validated user token of the given type.
+func validUserToken(typ string, scopes ...string) *validatedToken {
+	return &validatedToken{typ: typ, user: true, validated: true, valid: true, scopes: scopes}
+}
+
+// scopeTestConfig runs channel_subscribers_total and channel_chatters_total for
+// dam0un and surdaft.
+func scopeTestConfig() collector.Config {
+	enabled := true
+	return collector.Config{
+		Channels: collector.ChannelNames{"dam0un", "surdaft"}.Channels(),
+		Collectors: map[string]collector.CollectorConfig{
+			"channel_subscribers_total": {Enabled: &enabled},
+			"channel_chatters_total":    {Enabled: &enabled},
+		},
+	}
+}
+
+// runsFor returns the channels the collector runs for with cfg.
+func runsFor(cfg collector.Config, name string) []string {
+	for _, required := range collector.RequiredTokens(cfg) {
+		if required.Collector == name {
+			var channels []string
+			for _, channel := range required.Channels {
+				channels = append(channels, channel.Name)
+			}
+			return channels
+		}
+	}
+	return nil
+}
+
+func TestScopeCheckModes(t *testing.T) {
+	for _, tc := range []struct {
+		mode string
+		// chatters are the channels channel_chatters_total runs for, lacking
+		// moderator:read:chatters
+		chatters []string
+		fails    bool
+	}{
+		{mode: "warn", chatters: []string{"dam0un", "surdaft"}},
+		{mode: "skip"},
+		{mode: "fail", fails: true},
+	} {
+		t.Run(tc.mode, func(t *testing.T) {
+			c := newTestScopeChecker(tc.mode, nil, validUserToken("user", "channel:read:subscriptions"))
+
+			checked, err := c.check(scopeTestConfig())
+			if tc.fails {
+				if err == nil || !strings.Contains(err.Error(), "channel_chatters_total") {
+					t.Errorf("expected channel_chatters_total to fail the check, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := runsFor(checked, "channel_chatters_total"); !reflect.DeepEqual(got, tc.chatters) {
+				t.Errorf("expected channel_chatters_total to run for %v, got %v", tc.chatters, got)
+			}
+			// collectors whose scopes were granted are left unchanged
+			if got := runsFor(checked, "channel_subscribers_total"); !reflect.DeepEqual(got, []string{"dam0un", "surdaft"}) {
+				t.Errorf("expected channel_subscribers_total to run for every channel, got %v", got)
+			}
+		})
+	}
+}
+
+func TestScopeCheckUncheckedTokens(t *testing.T) {
+	for name, token := range map[string]*validatedToken{
+		"not validated": {typ: "user", user: true},
+		"invalid":       {typ: "user", user: true, validated: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := newTestScopeChecker("fail", nil, token)
+			if _, err := c.check(scopeTestConfig()); err != nil {
+				t.Errorf("expected tokens without a validation not to be checked, got %v", err)
+			}
+		})
+	}
+}
+
+func TestScopeCheckAppToken(t *testing.T) {
+	c := newTestScopeChecker("skip", nil, &validatedToken{typ: "user", validated: true, valid: true})
+
+	checked, err := c.check(scopeTestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"channel_subscribers_total", "channel_chatters_total"} {
+		if got := runsFor(checked, name); got != nil {
+			t.Errorf("expected %s to be skipped without a user token, got %v", name, got)
+		}
+	}
+}
+
+func TestScopeCheckSkipsBroadcasterChannels(t *testing.T) {
+	s := helixtest.NewServer()
+	t.Cleanup(s.Close)
+	s.Respond("/users?login=surdaft", `{"data": [{"id": "2", "login": "surdaft", "display_name": "surdaft"}]}`)
+	client, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	broadcaster, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := collector.NewClientRouter(promslog.NewNopLogger(), client, map[string]collector.HelixClient{"surdaft": broadcaster})
+
+	// only the token of surdaft lacks moderator:read:chatters
+	c := newTestScopeChecker("skip", router,
+		validUserToken("user", "channel:read:subscriptions", "moderator:read:chatters"),
+		validUserToken("user:surdaft", "channel:read:subscriptions"),
+	)
+
+	cfg := scopeTestConfig()
+	checked, err := c.check(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := runsFor(checked, "channel_chatters_total"); !reflect.DeepEqual(got, []string{"dam0un"}) {
+		t.Errorf("expected channel_chatters_total to only run for dam0un, got %v", got)
+	}
+	if got := runsFor(cfg, "channel_chatters_total"); len(got) != 2 {
+		t.Errorf("expected the checked configuration to be left unchanged, got %v", got)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 Damien PLÉNARD.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// tokenState is the content of the token state file.
+type tokenState struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// persist writes the tokens to the files they are read from and to the state
+// file, if any. Each file is replaced atomically so that a crash never leaves
+// a truncated token behind.
+func (t userToken) persist(accessToken, refreshToken string) error {
+	if t.accessTokenFile != "" {
+		if err := writeFileAtomic(t.accessTokenFile, []byte(accessToken+"\n")); err != nil {
+			return err
+		}
+	}
+	if t.refreshTokenFile != "" {
+		if err := writeFileAtomic(t.refreshTokenFile, []byte(refreshToken+"\n")); err != nil {
+			return err
+		}
+	}
+	if t.stateFile != "" {
+		data, err := json.Marshal(tokenState{AccessToken: accessToken, RefreshToken: refreshToken})
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(t.stateFile, append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readState returns the tokens of the state file, ok is false when there is
+// no state file yet or when a token file was modified after it, e.g. by a
+// sidecar or an operator.
+func (t userToken) readState() (accessToken, refreshToken string, ok bool, err error) {
+	if t.stateFile == "" {
+		return "", "", false, nil
+	}
+
+	info, err := os.Stat(t.stateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", "", false, nil
+	}
+	if err != nil {
+		return "", "", false, fmt.Errorf("reading token state: %w", err)
+	}
+
+	for _, file := range []string{t.accessTokenFile, t.refreshTokenFile} {
+		if file == "" {
+			continue
+		}
+		// an unreadable token file is reported when reading it
+		if fileInfo, err := os.Stat(file); err != nil || fileInfo.ModTime().After(info.ModTime()) {
+			return "", "", false, nil
+		}
+	}
+
+	data, err := os.ReadFile(t.stateFile)
+	if err != nil {
+		return "", "", false, fmt.Errorf("reading token state: %w", err)
+	}
+	var state tokenState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return "", "", false, fmt.Errorf("parsing token state %s: %w", t.stateFile, err)
+	}
+	if state.AccessToken == "" || state.RefreshToken == "" {
+		return "", "", false, fmt.Errorf("token state %s: missing access or refresh token", t.stateFile)
+	}
+
+	return state.AccessToken, state.RefreshToken, true, nil
+}
+
+// writeFileAtomic writes data to a temporary file only readable by its owner
+// and renames it to path.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	// removing the temporary file fails once it is renamed
+	defer os.Remove(f.Name())
+
+	if err := f.Chmod(0o600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 Damien PLÉNARD.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestUserToken(t *testing.T) userToken {
+	t.Helper()
+
+	dir := t.TempDir()
+	return userToken{
+		accessTokenFile:  filepath.Join(dir, "access_token"),
+		refreshTokenFile: filepath.Join(dir, "refresh_token"),
+		stateFile:        filepath.Join(dir, "token_state.json"),
+	}
+}
+
+func expectTokens(t *testing.T, token userToken, accessToken, refreshToken string) {
+	t.Helper()
+
+	gotAccess, gotRefresh, err := token.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotAccess != accessToken || gotRefresh != refreshToken {
+		t.Errorf("expected tokens %q and %q, got %q and %q", accessToken, refreshToken, gotAccess, gotRefresh)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access_token")
+	if err := os.WriteFile(path, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(path, []byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new\n" {
+		t.Errorf("expected the file to be replaced, got %q", data)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("expected the file to only be readable by its owner, got %v", perm)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected the temporary file to be renamed, got %d files", len(entries))
+	}
+}
+
+func TestWriteFileAtomicMissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "access_token")
+	if err := writeFileAtomic(path, []byte("new\n")); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestUserTokenPersistRoundTrip(t *testing.T) {
+	token := newTestUserToken(t)
+
+	if err := token.persist("access", "refresh"); err != nil {
+		t.Fatal(err)
+	}
+	for path, expected := range map[string]string{token.accessTokenFile: "access\n", token.refreshTokenFile: "refresh\n"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("expected %s to contain %q, got %q", path, expected, data)
+		}
+	}
+
+	accessToken, refreshToken, ok, err := token.readState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || accessToken != "access" || refreshToken != "refresh" {
+		t.Errorf("expected the persisted state, got %q and %q (ok: %v)", accessToken, refreshToken, ok)
+	}
+	expectTokens(t, token, "access", "refresh")
+
+	// refreshed tokens replace the previous ones
+	if err := token.persist("access2", "refresh2"); err != nil {
+		t.Fatal(err)
+	}
+	expectTokens(t, token, "access2", "refresh2")
+}
+
+func TestUserTokenStateOnly(t *testing.T) {
+	token := userToken{accessToken: "flag", refreshToken: "flag", stateFile: filepath.Join(t.TempDir(), "token_state.json")}
+
+	// the tokens given as flags are used until the first refresh
+	expectTokens(t, token, "flag", "flag")
+
+	if err := token.persist("access", "refresh"); err != nil {
+		t.Fatal(err)
+	}
+	expectTokens(t, token, "access", "refresh")
+}
+
+func TestUserTokenFileNewerThanState(t *testing.T) {
+	token := newTestUserToken(t)
+	if err := token.persist("access", "refresh"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a token file replaced by an operator takes precedence over the state
+	if err := os.WriteFile(token.accessTokenFile, []byte("operator\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(token.accessTokenFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, ok, err := token.readState(); err != nil || ok {
+		t.Errorf("expected the state to be ignored, got ok: %v, err: %v", ok, err)
+	}
+	expectTokens(t, token, "operator", "refresh")
+}
+
+func TestUserTokenInvalidState(t *testing.T) {
+	token := userToken{stateFile: filepath.Join(t.TempDir(), "token_state.json")}
+	for _, content := range []string{"not json", `{"access_token": "access"}`} {
+		if err := os.WriteFile(token.stateFile, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := token.read(); err == nil {
+			t.Errorf("expected an error for the state %q", content)
+		}
+	}
+}
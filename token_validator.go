@@ -0,0 +1,281 @@
+// Copyright 2020 Damien PLÉNARD.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/nicklaw5/helix/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// minTokenRecheck bounds the interval between validations when a token is
+// invalid or about to expire and its refresh keeps failing.
+const minTokenRecheck = time.Minute
+
+var (
+	tokenValidateInterval = kingpin.Flag("twitch.token-validate-interval",
+		"Interval at which the app and user tokens are validated with Twitch.").
+		Default("1h").Duration()
+	tokenRefreshBefore = kingpin.Flag("twitch.token-refresh-before",
+		"Refresh the tokens expiring within this duration, or invalid, as soon as they are validated.").
+		Default("10m").Duration()
+
+	tokenExpiryDesc = prometheus.NewDesc(
+		prometheus.BuildFQName("twitch", "token", "expiry_timestamp_seconds"),
+		"Expiry time of the token, as of its last validation.",
+		[]string{"type"}, nil,
+	)
+	tokenValidDesc = prometheus.NewDesc(
+		prometheus.BuildFQName("twitch", "token", "valid"),
+		"Whether the token was valid at its last validation.",
+		[]string{"type"}, nil,
+	)
+	tokenScopeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName("twitch", "token", "scope_info"),
+		"Scopes granted to the token, as of its last validation.",
+		[]string{"type", "scope"}, nil,
+	)
+)
+
+// validatedToken is the token of a client along with the outcome of its last
+// validation.
+type validatedToken struct {
+	typ     string
+	client  *helix.Client
+	user    bool
+	refresh func()
+
+	validated bool
+	valid     bool
+	// expiry is zero when the token does not expire.
+	expiry time.Time
+	login  string
+	userID string
+	scopes []string
+	// ownerID is the user ID of the owner of the token as of its last
+	// successful validation, kept once the token turns invalid.
+	ownerID string
+}
+
+// accessToken returns the token currently used by the client.
+func (t *validatedToken) accessToken() string {
+	if t.user {
+		return t.client.GetUserAccessToken()
+	}
+	return t.client.GetAppAccessToken()
+}
+
+// expiring returns whether the token should be refreshed at now.
+func (t *validatedToken) expiring(now time.Time, refreshBefore time.Duration) bool {
+	return !t.valid || (!t.expiry.IsZero() && t.expiry.Sub(now) < refreshBefore)
+}
+
+// tokenValidator validates the tokens of the clients periodically with
+// Twitch, so that a dead token is noticed before the collectors fail, and
+// refreshes the tokens which are invalid or about to expire. It implements
+// prometheus.Collector, exposing the expiry, validity and scopes of each
+// token by type: app, user or user:<channel>.
+type tokenValidator struct {
+	logger *slog.Logger
+	// client sends the validation requests, separate from the validated
+	// clients as validating swaps the token of the client.
+	client        *helix.Client
+	interval      time.Duration
+	refreshBefore time.Duration
+
+	mtx    sync.Mutex
+	tokens []*validatedToken
+}
+
+func newTokenValidator(logger *slog.Logger, httpClient helix.HTTPClient) (*tokenValidator, error) {
+	client, err := helix.NewClient(&helix.Options{
+		ClientID:   *twitchClientID,
+		HTTPClient: httpClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenValidator{
+		logger:        logger,
+		client:        client,
+		interval:      *tokenValidateInterval,
+		refreshBefore: *tokenRefreshBefore,
+	}, nil
+}
+
+// Add registers the app or user token of client under typ, refresh is called
+// when the token must be refreshed.
+func (v *tokenValidator) Add(typ string, client *helix.Client, user bool, refresh func()) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	v.tokens = append(v.tokens, &validatedToken{typ: typ, client: client, user: user, refresh: refresh})
+}
+
+// Validate validates every token, refreshing and validating again the ones
+// which are invalid or about to expire.
+func (v *tokenValidator) Validate() {
+	v.mtx.Lock()
+	tokens := slices.Clone(v.tokens)
+	v.mtx.Unlock()
+
+	for _, token := range tokens {
+		if !v.validate(token) {
+			continue
+		}
+		if v.expiringToken(token) {
+			v.logger.Info("refreshing invalid or expiring token", "type", token.typ)
+			token.refresh()
+			v.validate(token)
+		}
+	}
+}
+
+// ValidateClient validates the user token of client, e.g. once it was
+// replaced.
+func (v *tokenValidator) ValidateClient(client *helix.Client) {
+	v.mtx.Lock()
+	var tokens []*validatedToken
+	for _, token := range v.tokens {
+		if token.client == client && token.user {
+			tokens = append(tokens, token)
+		}
+	}
+	v.mtx.Unlock()
+
+	for _, token := range tokens {
+		v.validate(token)
+	}
+}
+
+// validate validates the token, it returns false when the validation could
+// not be completed, the previous outcome being kept.
+func (v *tokenValidator) validate(token *validatedToken) bool {
+	valid, resp, err := v.client.ValidateToken(token.accessToken())
+	if err != nil {
+		v.logger.Error("Error validating token", "type", token.typ, "err", err)
+		return false
+	}
+
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	token.validated = true
+	token.valid = valid
+	token.expiry, token.login, token.userID, token.scopes = time.Time{}, "", "", nil
+	if !valid {
+		v.logger.Warn("token is invalid", "type", token.typ, "err", resp.ErrorMessage)
+		return true
+	}
+
+	if resp.Data.ExpiresIn > 0 {
+		token.expiry = time.Now().Add(time.Duration(resp.Data.ExpiresIn) * time.Second)
+	}
+	token.login, token.userID = resp.Data.Login, resp.Data.UserID
+	if token.userID != "" {
+		token.ownerID = token.userID
+	}
+	token.scopes = slices.Sorted(slices.Values(resp.Data.Scopes))
+	v.logger.Debug("token validated", "type", token.typ, "login", token.login, "expiry", token.expiry, "scopes", token.scopes)
+	return true
+}
+
+func (v *tokenValidator) expiringToken(token *validatedToken) bool {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	return token.expiring(time.Now(), v.refreshBefore)
+}
+
+// token returns a copy of the token registered under typ, as of its last
+// validation.
+func (v *tokenValidator) token(typ string) (validatedToken, bool) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	for _, token := range v.tokens {
+		if token.typ == typ {
+			return *token, true
+		}
+	}
+	return validatedToken{}, false
+}
+
+// next returns the delay until the next validation: the interval, unless a
+// token reaches the refresh window sooner, or is invalid, its refresh having
+// failed, in which case it is checked again after minTokenRecheck.
+func (v *tokenValidator) next() time.Duration {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	next := v.interval
+	for _, token := range v.tokens {
+		if token.validated && !token.valid {
+			next = min(next, minTokenRecheck)
+			continue
+		}
+		if token.expiry.IsZero() {
+			continue
+		}
+		if d := time.Until(token.expiry.Add(-v.refreshBefore)); d < next {
+			next = max(d, minTokenRecheck)
+		}
+	}
+	return next
+}
+
+// Run validates the tokens until ctx is done, the tokens are expected to have
+// been validated once already.
+func (v *tokenValidator) Run(ctx context.Context) {
+	timer := time.NewTimer(v.next())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			v.Validate()
+			timer.Reset(v.next())
+		}
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (v *tokenValidator) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tokenExpiryDesc
+	ch <- tokenValidDesc
+	ch <- tokenScopeDesc
+}
+
+// Collect implements prometheus.Collector.
+func (v *tokenValidator) Collect(ch chan<- prometheus.Metric) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	for _, token := range v.tokens {
+		if !token.validated {
+			continue
+		}
+
+		valid := 0.0
+		if token.valid {
+			valid = 1
+		}
+		ch <- prometheus.MustNewConstMetric(tokenValidDesc, prometheus.GaugeValue, valid, token.typ)
+		if !token.expiry.IsZero() {
+			ch <- prometheus.MustNewConstMetric(tokenExpiryDesc, prometheus.GaugeValue, float64(token.expiry.Unix()), token.typ)
+		}
+		for _, scope := range token.scopes {
+			ch <- prometheus.MustNewConstMetric(tokenScopeDesc, prometheus.GaugeValue, 1, token.typ, scope)
+		}
+	}
+}
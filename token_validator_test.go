@@ -0,0 +1,181 @@
+// Copyright 2020 Damien PLÉNARD.
+// Licensed under the MIT License
+
+package main
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/damoun/twitch_exporter/internal/helixtest"
+	"github.com/nicklaw5/helix/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promslog"
+)
+
+// newTestValidator returns a validator of the tokens of the server, along with
+// a client holding a user token of dam0un.
+func newTestValidator(t *testing.T) (*helixtest.Server, *tokenValidator, *helix.Client) {
+	t.Helper()
+
+	previous := *twitchClientID
+	*twitchClientID = helixtest.ClientID
+	t.Cleanup(func() { *twitchClientID = previous })
+
+	s := helixtest.NewServer()
+	t.Cleanup(s.Close)
+	client, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetUserAccessToken(helixtest.AccessToken)
+
+	v, err := newTokenValidator(promslog.NewNopLogger(), s.HTTPClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, v, client
+}
+
+func TestTokenValidatorValid(t *testing.T) {
+	_, v, client := newTestValidator(t)
+	var refreshes atomic.Int32
+	v.Add("user", client, true, func() { refreshes.Add(1) })
+
+	v.Validate()
+
+	token, ok := v.token("user")
+	if !ok || !token.valid || token.ownerID != "1" || token.login != "dam0un" {
+		t.Errorf("expected a valid token of dam0un, got %+v", token)
+	}
+	if n := refreshes.Load(); n != 0 {
+		t.Errorf("expected a valid token not to be refreshed, got %d refreshes", n)
+	}
+	if next := v.next(); next != v.interval {
+		t.Errorf("expected the next validation after the interval, got %v", next)
+	}
+
+	expected := `
+# HELP twitch_token_scope_info Scopes granted to the token, as of its last validation.
+# TYPE twitch_token_scope_info gauge
+twitch_token_scope_info{scope="bits:read",type="user"} 1
+twitch_token_scope_info{scope="channel:read:subscriptions",type="user"} 1
+# HELP twitch_token_valid Whether the token was valid at its last validation.
+# TYPE twitch_token_valid gauge
+twitch_token_valid{type="user"} 1
+`
+	if err := testutil.CollectAndCompare(v, strings.NewReader(expected), "twitch_token_scope_info", "twitch_token_valid"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTokenValidatorInvalid(t *testing.T) {
+	s, v, client := newTestValidator(t)
+	var refreshes atomic.Int32
+	v.Add("user", client, true, func() { refreshes.Add(1) })
+	v.Validate()
+
+	s.Error("/oauth2/validate", 401, "invalid access token")
+	v.Validate()
+
+	token, _ := v.token("user")
+	if token.valid {
+		t.Error("expected the token to be invalid")
+	}
+	if token.ownerID != "1" {
+		t.Errorf("expected the owner of the token to be kept, got %q", token.ownerID)
+	}
+	if n := refreshes.Load(); n != 1 {
+		t.Errorf("expected the invalid token to be refreshed once, got %d refreshes", n)
+	}
+	if next := v.next(); next != minTokenRecheck {
+		t.Errorf("expected the invalid token to be checked again after %v, got %v", minTokenRecheck, next)
+	}
+}
+
+func TestTokenValidatorExpiring(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		expiresIn string
+		next      time.Duration
+	}{
+		{name: "refresh window within the interval", expiresIn: "1800", next: 20 * time.Minute},
+		{name: "refresh window reached", expiresIn: "60", next: minTokenRecheck},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, v, client := newTestValidator(t)
+			s.Respond("/oauth2/validate", `{"login": "dam0un", "user_id": "1", "expires_in": `+tc.expiresIn+`}`)
+			// refreshing leaves the token unchanged
+			v.Add("user", client, true, func() {})
+			v.Validate()
+
+			// the validation takes some time, the next one is slightly sooner
+			if next := v.next(); next > tc.next || next < tc.next-time.Minute {
+				t.Errorf("expected the next validation after about %v, got %v", tc.next, next)
+			}
+		})
+	}
+}
+
+func TestTokenValidatorRun(t *testing.T) {
+	s, v, client := newTestValidator(t)
+	s.Error("/oauth2/validate", 401, "invalid access token")
+	var refreshes atomic.Int32
+	v.Add("user", client, true, func() { refreshes.Add(1) })
+	v.Validate()
+
+	// invalid tokens are checked again after the interval when it is shorter
+	// than the recheck of invalid tokens
+	v.interval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		v.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for refreshes.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("invalid token not checked again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// a valid token is then reported as such
+	s.Respond("/oauth2/validate", `{"login": "dam0un", "user_id": "1", "expires_in": 14400}`)
+	for {
+		if token, _ := v.token("user"); token.valid {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("token not validated again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
+
+func TestTokenValidatorValidateClient(t *testing.T) {
+	s, v, client := newTestValidator(t)
+	other, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Add("user", client, true, func() {})
+	v.Add("app", other, false, func() {})
+
+	v.ValidateClient(client)
+
+	if token, _ := v.token("user"); !token.validated {
+		t.Error("expected the token of the client to be validated")
+	}
+	if token, _ := v.token("app"); token.validated {
+		t.Error("expected the token of the other client not to be validated")
+	}
+}
@@ -4,17 +4,23 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	kingpin "github.com/alecthomas/kingpin/v2"
 	"github.com/damoun/twitch_exporter/collector"
+	"github.com/damoun/twitch_exporter/internal/config"
 	"github.com/damoun/twitch_exporter/internal/eventsub"
+	"github.com/damoun/twitch_exporter/internal/helixmetrics"
 	"github.com/nicklaw5/helix/v2"
 	"github.com/prometheus/client_golang/prometheus"
 	versioncollector "github.com/prometheus/client_golang/prometheus/collectors/version"
@@ -33,7 +39,7 @@ var (
 
 	// twitch app access token config
 	twitchClientID = kingpin.Flag("twitch.client-id",
-		"Client ID for the Twitch Helix API.").Required().String()
+		"Client ID for the Twitch Helix API.").String()
 	twitchClientSecret = kingpin.Flag("twitch.client-secret",
 		"Client Secret for the Twitch Helix API.").String()
 
@@ -46,6 +52,8 @@ var (
 		"File containing the Access Token for the Twitch Helix API.").String()
 	twitchRefreshTokenFile = kingpin.Flag("twitch.refresh-token-file",
 		"File containing the Refresh Token for the Twitch Helix API.").String()
+	twitchTokenStateFile = kingpin.Flag("twitch.token-state-file",
+		"File the refreshed user tokens are written to, and read from at startup when newer than the token files. Use it when the tokens are given directly rather than as files.").String()
 	eventSubEnabled = kingpin.Flag("eventsub.enabled",
 		"Enable the Twitch Eventsub API.").Default("false").Bool()
 	eventSubWebhookURL = kingpin.Flag("eventsub.webhook-url",
@@ -53,6 +61,13 @@ var (
 	eventSubWebhookSecret = kingpin.Flag("eventsub.webhook-secret",
 		"Secure 1-100 character secret for your eventsub validation.").Default("").String()
 
+	scrapeTimeoutOffset = kingpin.Flag("web.scrape-timeout-offset",
+		"Offset to subtract from the scrape timeout sent by Prometheus, leaving time to send the response.").
+		Default("0.5s").Duration()
+	pollInterval = kingpin.Flag("collector.poll-interval",
+		"Interval at which collectors are updated in the background, scrapes are then served from the last results. When 0, collectors are updated on every scrape.").
+		Default("0s").Duration()
+
 	// collector configs
 	// the twitch channel is a global config for all collectors, and is
 	// defined at the root level. Individual collectors may have their own
@@ -89,11 +104,66 @@ func getTokenValue(filePath, directValue string) (string, error) {
 	return directValue, nil
 }
 
+// userToken is a user access and refresh token pair, each given directly or
+// as the path of a file containing it. Refreshed pairs are written back to the
+// token files and to the state file, if any.
+type userToken struct {
+	accessToken      string
+	accessTokenFile  string
+	refreshToken     string
+	refreshTokenFile string
+	stateFile        string
+}
+
+// flagUserToken returns the user token given with the --twitch.access-token
+// and --twitch.refresh-token flags.
+func flagUserToken() userToken {
+	return userToken{
+		accessToken:      *twitchAccessToken,
+		accessTokenFile:  *twitchAccessTokenFile,
+		refreshToken:     *twitchRefreshToken,
+		refreshTokenFile: *twitchRefreshTokenFile,
+		stateFile:        *twitchTokenStateFile,
+	}
+}
+
+// isSet returns true if both the access and the refresh tokens are provided.
+func (t userToken) isSet() bool {
+	hasAccessToken := t.accessToken != "" || t.accessTokenFile != ""
+	hasRefreshToken := t.refreshToken != "" || t.refreshTokenFile != ""
+	return hasAccessToken && hasRefreshToken
+}
+
+// fromFiles returns true if any token is read from a file.
+func (t userToken) fromFiles() bool {
+	return t.accessTokenFile != "" || t.refreshTokenFile != ""
+}
+
+// persisted returns true if the token is read from files it is persisted to.
+func (t userToken) persisted() bool {
+	return t.fromFiles() || t.stateFile != ""
+}
+
+// read returns the access and refresh tokens, reading their files if any. The
+// pair of the state file is preferred when it is not older than the token
+// files, as it was persisted after the last refresh.
+func (t userToken) read() (accessToken, refreshToken string, err error) {
+	if accessToken, refreshToken, ok, err := t.readState(); err != nil || ok {
+		return accessToken, refreshToken, err
+	}
+
+	if accessToken, err = getTokenValue(t.accessTokenFile, t.accessToken); err != nil {
+		return "", "", fmt.Errorf("reading access token: %w", err)
+	}
+	if refreshToken, err = getTokenValue(t.refreshTokenFile, t.refreshToken); err != nil {
+		return "", "", fmt.Errorf("reading refresh token: %w", err)
+	}
+	return accessToken, refreshToken, nil
+}
+
 // hasUserTokenConfig returns true if user access token configuration is provided.
 func hasUserTokenConfig() bool {
-	hasAccessToken := *twitchAccessToken != "" || *twitchAccessTokenFile != ""
-	hasRefreshToken := *twitchRefreshToken != "" || *twitchRefreshTokenFile != ""
-	return hasAccessToken && hasRefreshToken
+	return flagUserToken().isSet()
 }
 
 func init() {
@@ -107,14 +177,33 @@ func main() {
 	var webConfig = webflag.AddFlags(kingpin.CommandLine, "0.0.0.0:9184")
 	kingpin.Version(version.Print("twitch_exporter"))
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
+	command := kingpin.Parse()
 
 	logger := promslog.New(promslogConfig)
+
+	if command == authLoginCommand.FullCommand() {
+		if err := runAuthLogin(logger); err != nil {
+			logger.Error("Error logging in", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	logger.Info("Starting twitch_exporter", "version", version.Info())
 	logger.Info("", "build_context", version.BuildContext())
 
+	cfg, err := loadConfig()
+	if err != nil {
+		logger.Error("Error loading the configuration file", "file", *configFile, "err", err)
+		os.Exit(1)
+	}
+	applyStartupConfig(cfg)
+
 	var client *helix.Client
-	var err error
+
+	// every request to the Twitch API goes through an instrumented client,
+	// one per token as each token has its own rate limit bucket
+	helixMetrics := helixmetrics.New()
 
 	clientType := "app"
 
@@ -129,32 +218,35 @@ func main() {
 
 	logger.Info("client type determined", "clientType", clientType)
 
+	rateLimiter := helixMetrics.Client(clientType)
+
 	switch clientType {
 	case "app":
-		client, err = newClientWithSecret(logger)
+		client, err = newClientWithSecret(logger, rateLimiter)
 		if err != nil {
 			logger.Error("Error creating the client", "err", err)
 			os.Exit(1)
 		}
 	case "user":
-		client, err = newClientWithUserAccessToken(logger)
+		client, err = newClientWithUserAccessToken(logger, rateLimiter, flagUserToken())
 		if err != nil {
 			logger.Error("Error creating the client", "err", err)
 			os.Exit(1)
 		}
 	}
 
-	var eventsubClient *eventsub.Client
+	var (
+		eventsubClient *eventsub.Client
+		appClient      *helix.Client
+	)
 
 	if *eventSubEnabled {
 		logger.Info("eventsub endpoint enabled", "endpoint", "/eventsub")
 
-		var appClient *helix.Client
-
 		// eventsub requires an app client to create webhooks, but we may have created a user client
 		// beforehand for subscription metrics, so just check and create the app client if needed
 		if clientType == "user" {
-			appClient, err = newClientWithSecret(logger)
+			appClient, err = newClientWithSecret(logger, helixMetrics.Client("app"))
 			if err != nil {
 				logger.Error("Error creating the client", "err", err)
 				os.Exit(1)
@@ -186,25 +278,140 @@ func main() {
 		http.HandleFunc("/eventsub", eventsubClient.Handler())
 	}
 
-	exporter, err := collector.NewExporter(logger, client, eventsubClient, *twitchChannel)
+	// channels are discovered once before the exporter is created, so that the
+	// first scrape already covers them
+	discoveryManager, err := newDiscoveryManager(logger, client, rateLimiter)
+	if err != nil {
+		logger.Error("Error creating the channel discovery", "err", err)
+		os.Exit(1)
+	}
+	discoveryManager.Refresh(context.Background())
+
+	// requests of the broadcasters with their own token are sent with it
+	broadcasters, err := newBroadcasterClients(logger, helixMetrics, cfg.Credentials.Channels)
+	if err != nil {
+		logger.Error("Error creating the broadcaster clients", "err", err)
+		os.Exit(1)
+	}
+
+	// every token is validated before the exporter starts, then periodically
+	tokens, err := newTokenValidator(logger, helixMetrics.Client("validate"))
+	if err != nil {
+		logger.Error("Error creating the token validator", "err", err)
+		os.Exit(1)
+	}
+	if clientType == "user" {
+		tokens.Add("user", client, true, func() { refreshUserAccessToken(logger, client, flagUserToken()) })
+	} else {
+		tokens.Add("app", client, false, func() { refreshAppAccessToken(logger, client) })
+	}
+	if appClient != nil && appClient != client {
+		tokens.Add("app", appClient, false, func() { refreshAppAccessToken(logger, appClient) })
+	}
+	for _, channel := range slices.Sorted(maps.Keys(broadcasters)) {
+		target := broadcasters[channel]
+		tokens.Add("user:"+channel, target.client, true, func() {
+			refreshUserAccessToken(logger.With("channel", channel), target.client, target.token)
+		})
+	}
+	tokens.Validate()
+
+	var (
+		exporterClient collector.HelixClient = client
+		router         *collector.ClientRouter
+	)
+	if len(broadcasters) > 0 {
+		clients := make(map[string]collector.HelixClient, len(broadcasters))
+		for channel, target := range broadcasters {
+			clients[channel] = target.client
+		}
+		router = collector.NewClientRouter(logger, client, clients)
+		exporterClient = router
+	}
+
+	// the collectors are checked against the validated tokens before they
+	// start, then on every configuration change
+	scopes := newScopeChecker(logger, tokens, clientType, router)
+	static := collectorConfig(cfg)
+	initial, err := scopes.check(withDiscovered(static, discoveryManager))
+	if err != nil {
+		logger.Error("Error checking the collector tokens", "err", err)
+		os.Exit(1)
+	}
+
+	exporter, err := collector.NewExporterWithConfig(logger, exporterClient, eventsubClient, initial)
 	if err != nil {
 		logger.Error("Error creating the exporter", "err", err)
 		os.Exit(1)
 	}
 
-	r := prometheus.NewRegistry()
-	r.MustRegister(exporter)
+	// low priority collectors are paused while the budget of any token they
+	// request the API with is nearly exhausted
+	rateLimiters := collector.RateLimiters{rateLimiter}
+	for _, channel := range slices.Sorted(maps.Keys(broadcasters)) {
+		rateLimiters = append(rateLimiters, helixMetrics.Client("user:"+channel))
+	}
+	exporter.SetRateLimiter(rateLimiters)
+
+	if *pollInterval > 0 {
+		logger.Info("polling collectors in the background", "interval", *pollInterval)
+		exporter.StartPolling(*pollInterval)
+	}
+
+	// metrics of the exporter itself, exposed alongside the collector metrics
+	exporterRegistry := prometheus.NewRegistry()
+	exporterRegistry.MustRegister(helixMetrics, tokens)
+	go tokens.Run(context.Background())
+
+	configReloadSuccess.Set(1)
+	configReloadSeconds.SetToCurrentTime()
+	exporterRegistry.MustRegister(configReloadSuccess, configReloadSeconds)
+
+	reloader := &configReloader{logger: logger, exporter: exporter, discovery: discoveryManager, scopes: scopes, startup: cfg, static: static}
+	reloader.watchSignals()
+	http.HandleFunc("/-/reload", reloader.handler)
+
+	if discoveryManager.Enabled() {
+		exporterRegistry.MustRegister(discoveryManager)
+		go discoveryManager.Run(context.Background(), reloader.reapply)
+	}
+
+	http.HandleFunc(*metricsPath, func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := scrapeContext(r)
+		defer cancel()
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(exporter.WithContext(ctx))
+
+		promhttp.HandlerFor(prometheus.Gatherers{exporterRegistry, registry}, promhttp.HandlerOpts{
+			ErrorLog:      promHTTPLogger{logger: logger},
+			ErrorHandling: promhttp.ContinueOnError,
+		}).ServeHTTP(w, r)
+	})
+
+	if *oauthRedirectURL != "" {
+		oauth, err := newOAuthHandler(logger, helixMetrics.Client("oauth"), exporter, tokens, reloader.reapply, tokenTarget{client: client, token: flagUserToken()}, broadcasters)
+		if err != nil {
+			logger.Error("Error creating the OAuth client", "err", err)
+			os.Exit(1)
+		}
+		logger.Info("OAuth login enabled", "endpoint", "/oauth/login", "redirect_url", *oauthRedirectURL)
+		http.HandleFunc("/oauth/login", oauth.login)
+		http.HandleFunc("/oauth/callback", oauth.callback)
+	}
 
-	http.Handle(*metricsPath, promhttp.HandlerFor(r, promhttp.HandlerOpts{
-		ErrorLog:      promHTTPLogger{logger: logger},
-		ErrorHandling: promhttp.ContinueOnError,
-	}))
+	http.HandleFunc("/probe", func(w http.ResponseWriter, r *http.Request) {
+		probeHandler(w, r, logger, exporter)
+	})
 
 	landingTmpl := template.Must(template.New("landing").Parse(`<html>
              <head><title>Twitch Exporter</title></head>
              <body>
              <h1>Twitch Exporter</h1>
              <p><a href='{{.MetricsPath}}'>Metrics</a></p>
+             <form action='/probe'>
+             <p>Probe <input name='target' placeholder='channel'> <input type='submit' value='Probe'></p>
+             </form>
              <h2>Build</h2>
              <pre>{{.VersionInfo}} {{.BuildContext}}</pre>
              </body>
@@ -228,6 +435,22 @@ func main() {
 	}
 }
 
+// scrapeContext returns a context for the request which expires with the
+// scrape timeout sent by Prometheus, minus the scrape timeout offset.
+func scrapeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+		seconds, err := strconv.ParseFloat(v, 64)
+		if err == nil && seconds > 0 {
+			timeout := time.Duration(seconds*float64(time.Second)) - *scrapeTimeoutOffset
+			if timeout > 0 {
+				return context.WithTimeout(r.Context(), timeout)
+			}
+		}
+	}
+
+	return context.WithCancel(r.Context())
+}
+
 func refreshAppAccessToken(logger *slog.Logger, client *helix.Client) {
 	logger.Info("Refreshing app access token")
 	appAccessToken, err := client.RequestAppAccessToken([]string{})
@@ -244,26 +467,24 @@ func refreshAppAccessToken(logger *slog.Logger, client *helix.Client) {
 	client.SetAppAccessToken(appAccessToken.Data.AccessToken)
 }
 
-func refreshUserAccessToken(logger *slog.Logger, client *helix.Client) {
+func refreshUserAccessToken(logger *slog.Logger, client *helix.Client, token userToken) {
 	logger.Info("Refreshing user access token")
 
-	// If using file-based tokens, re-read them from files (allows external
-	// components/sidecars to update the tokens)
-	if *twitchAccessTokenFile != "" || *twitchRefreshTokenFile != "" {
-		accessToken, err := getTokenValue(*twitchAccessTokenFile, *twitchAccessToken)
+	// If using persisted tokens, re-read them first (allows external
+	// components/sidecars to update the tokens), the token is only refreshed
+	// when the persisted pair is the one in use
+	if token.persisted() {
+		accessToken, refreshToken, err := token.read()
 		if err != nil {
-			logger.Error("Error reading access token", "err", err)
+			logger.Error("Error reading user token", "err", err)
 			return
 		}
-		refreshToken, err := getTokenValue(*twitchRefreshTokenFile, *twitchRefreshToken)
-		if err != nil {
-			logger.Error("Error reading refresh token", "err", err)
+		if refreshToken != client.GetRefreshToken() {
+			client.SetUserAccessToken(accessToken)
+			client.SetRefreshToken(refreshToken)
+			logger.Info("User access token updated from file")
 			return
 		}
-		client.SetUserAccessToken(accessToken)
-		client.SetRefreshToken(refreshToken)
-		logger.Info("User access token refreshed from file")
-		return
 	}
 
 	userAccessToken, err := client.RefreshUserAccessToken(client.GetRefreshToken())
@@ -279,14 +500,20 @@ func refreshUserAccessToken(logger *slog.Logger, client *helix.Client) {
 
 	client.SetUserAccessToken(userAccessToken.Data.AccessToken)
 	client.SetRefreshToken(userAccessToken.Data.RefreshToken)
+
+	// refresh tokens are rotated, the new pair must survive a restart
+	if err := token.persist(userAccessToken.Data.AccessToken, userAccessToken.Data.RefreshToken); err != nil {
+		logger.Error("Error persisting user token", "err", err)
+	}
 }
 
 // newClientWithSecret creates a new Twitch client with the use of an app access
 // token.
-func newClientWithSecret(logger *slog.Logger) (*helix.Client, error) {
+func newClientWithSecret(logger *slog.Logger, httpClient helix.HTTPClient) (*helix.Client, error) {
 	client, err := helix.NewClient(&helix.Options{
 		ClientID:     *twitchClientID,
 		ClientSecret: *twitchClientSecret,
+		HTTPClient:   httpClient,
 	})
 
 	if err != nil {
@@ -306,18 +533,38 @@ func newClientWithSecret(logger *slog.Logger) (*helix.Client, error) {
 	return client, nil
 }
 
-// newClientWithUserAccessToken creates a new Twitch client with a user access token.
-// this is required for private data, such as subscriber counts.
-func newClientWithUserAccessToken(logger *slog.Logger) (*helix.Client, error) {
-	accessToken, err := getTokenValue(*twitchAccessTokenFile, *twitchAccessToken)
-	if err != nil {
-		logger.Error("Error reading access token", "err", err)
-		return nil, err
+// newBroadcasterClients creates a client for the user token of every channel
+// of the credentials, keyed by lowercase channel.
+func newBroadcasterClients(logger *slog.Logger, helixMetrics *helixmetrics.Metrics, tokens map[string]config.TokenConfig) (map[string]tokenTarget, error) {
+	targets := make(map[string]tokenTarget, len(tokens))
+	for channel, token := range tokens {
+		logger.Info("creating broadcaster client", "channel", channel)
+		target := tokenTarget{token: userToken{
+			accessToken:      token.AccessToken,
+			accessTokenFile:  token.AccessTokenFile,
+			refreshToken:     token.RefreshToken,
+			refreshTokenFile: token.RefreshTokenFile,
+			stateFile:        token.StateFile,
+		}}
+
+		var err error
+		key := strings.ToLower(channel)
+		target.client, err = newClientWithUserAccessToken(logger.With("channel", channel), helixMetrics.Client("user:"+key), target.token)
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", channel, err)
+		}
+		targets[key] = target
 	}
+	return targets, nil
+}
 
-	refreshToken, err := getTokenValue(*twitchRefreshTokenFile, *twitchRefreshToken)
+// newClientWithUserAccessToken creates a new Twitch client with a user access token.
+// this is required for private data, such as subscriber counts. The token is
+// refreshed in the background, independently of the other clients.
+func newClientWithUserAccessToken(logger *slog.Logger, httpClient helix.HTTPClient, token userToken) (*helix.Client, error) {
+	accessToken, refreshToken, err := token.read()
 	if err != nil {
-		logger.Error("Error reading refresh token", "err", err)
+		logger.Error("Error reading user token", "err", err)
 		return nil, err
 	}
 
@@ -329,6 +576,7 @@ func newClientWithUserAccessToken(logger *slog.Logger) (*helix.Client, error) {
 		ClientSecret:    *twitchClientSecret,
 		UserAccessToken: accessToken,
 		RefreshToken:    refreshToken,
+		HTTPClient:      httpClient,
 	})
 
 	if err != nil {
@@ -336,15 +584,23 @@ func newClientWithUserAccessToken(logger *slog.Logger) (*helix.Client, error) {
 		return nil, err
 	}
 
+	// the helix client refreshes the token by itself when a request is
+	// rejected, the new pair is persisted as well
+	client.OnUserAccessTokenRefreshed(func(accessToken, refreshToken string) {
+		if err := token.persist(accessToken, refreshToken); err != nil {
+			logger.Error("Error persisting user token", "err", err)
+		}
+	})
+
 	// it may be redundant to refresh the access token here, but it's done
 	// anyway to ensure the access token is always valid, in case the parameters
 	// are outdated
-	refreshUserAccessToken(logger, client)
+	refreshUserAccessToken(logger, client, token)
 
 	refreshTicker := time.NewTicker(24 * time.Hour)
 	go func(logger *slog.Logger, refreshTicker *time.Ticker, client *helix.Client) {
 		for range refreshTicker.C {
-			refreshUserAccessToken(logger, client)
+			refreshUserAccessToken(logger, client, token)
 		}
 	}(logger, refreshTicker, client)
 